@@ -0,0 +1,129 @@
+// Command gorun runs build targets written in Go.
+//
+// Targets are exported functions in files with the "gorun" build tag
+// which take no arguments and return a script.Task:
+//
+//     // +build gorun
+//
+//     package main
+//
+//     import "github.com/tvastar/gotools/pkg/script"
+//
+//     // Test runs all the tests.
+//     func Test() script.Task {
+//         return script.Cmd("go", "test", "./...")
+//     }
+//
+// The target files are compiled into a runner binary which is cached
+// across runs, keyed by the hash of the sources.  Target names are
+// matched ignoring case.
+//
+// Usage:
+//
+//    gorun [options] target...
+//
+// With no targets (or with -l), the available targets are listed.
+//
+// Options:
+//
+//   -cachedir string -- directory for cached task results
+//   -f string -- file or directory defining targets (default ".")
+//   -go string -- path of the "go" binary (default "go")
+//   -h	help
+//   -j int -- number of targets to run in parallel (default 1)
+//   -l	list targets
+//   -n	print the plan without running anything
+//   -nocache -- do not use cached task results
+//   -rebuild -- rebuild the runner binary
+//   -v	log targets as they run
+//
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/tvastar/gotools/pkg/gorun"
+)
+
+func main() {
+	opts := gorun.Options{Parallel: 1}
+	opts.RegisterFlags(flag.CommandLine)
+	path := flag.String("f", ".", "file or directory defining targets")
+	gobin := flag.String("go", "go", `path of the "go" binary`)
+	list := flag.Bool("l", false, "list targets")
+	rebuild := flag.Bool("rebuild", false, "rebuild the runner binary")
+	h := flag.Bool("h", false, "help")
+
+	flag.CommandLine.Usage = usage
+	flag.Parse()
+
+	if *h {
+		help()
+		return
+	}
+
+	files, err := gorun.Files(*path)
+	must(err)
+	targets, err := gorun.Discover(files)
+	must(err)
+
+	if *list || flag.NArg() == 0 {
+		gorun.List(os.Stdout, targets)
+		return
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	must(err)
+	binary, err := gorun.Compile(*gobin, files, targets, filepath.Join(cacheDir, "gotools", "gorun"), *rebuild)
+	must(err)
+
+	// the runner receives interrupts directly and exits on its own
+	signal.Ignore(os.Interrupt)
+
+	cmd := exec.Command(binary, append(opts.Args(), flag.Args()...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		must(err)
+	}
+}
+
+func must(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		os.Exit(1)
+	}
+}
+
+func help() {
+	fmt.Print(`
+Gorun runs build targets written in Go.
+
+Targets are exported functions in files with the "gorun" build tag
+which take no arguments and return a script.Task.  The target files
+are compiled into a runner binary which is cached across runs.
+
+`)
+	usage()
+}
+
+func usage() {
+	fmt.Print(`
+Usage:
+
+   gorun [options] target...
+
+With no targets (or with -l), the available targets are listed.
+
+Options:
+
+`)
+	flag.PrintDefaults()
+}
@@ -2,29 +2,67 @@
 //
 // Usage:
 //
-//   watch [optional_global_pattern]
+//   watch [options] [optional_global_pattern]
+//
+// Options:
+//
+//   -manifest url -- watch a JSON directory manifest served at url
+//                    instead of the current directory.
+//   -interval d   -- polling interval for -manifest (default 1m).
+//   -stats        -- print watcher stats to stderr on exit. The stats
+//                    are also published via expvar as "watch".
+//
+// A manifest is a JSON array of {"path", "size", "etag"} entries. The
+// paths of entries that are added, removed or modified are printed.
 package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"time"
 
 	"github.com/tvastar/gotools/pkg/watch"
 )
 
 func main() {
-	ctx := context.Background()
+	manifest := flag.String("manifest", "", "url of a JSON directory manifest to watch")
+	interval := flag.Duration("interval", time.Minute, "polling interval for -manifest")
+	stats := flag.Bool("stats", false, "print watcher stats on exit")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
 	glob := "**"
-	if len(os.Args) > 1 {
-		glob = os.Args[1]
+	if flag.NArg() > 0 {
+		glob = flag.Arg(0)
+	}
+
+	var m *watch.Monitor
+	if *stats {
+		m = watch.NewMonitor()
+		m.Publish("watch")
 	}
 
-	w := watch.CurrentDir(glob)
+	var w watch.Stream
+	if *manifest != "" {
+		w = m.Stream(m.Filter(watch.Glob(glob), watch.Manifest(nil, *manifest, *interval)))
+	} else {
+		w = watch.CurrentDirWithMonitor(glob, m)
+	}
 
 	for {
 		p, err := w.NextPath(ctx)
 		if err != nil {
+			if *stats {
+				fmt.Fprintln(os.Stderr, "Stats", m.Stats())
+			}
+			if ctx.Err() != nil {
+				return
+			}
 			fmt.Fprintln(os.Stderr, "Error", err)
 			os.Exit(1)
 		}
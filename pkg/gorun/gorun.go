@@ -0,0 +1,357 @@
+// Package gorun implements running build targets written in Go.
+//
+// Targets are exported functions which take no arguments and return
+// a script.Task:
+//
+//     // +build gorun
+//
+//     package main
+//
+//     import "github.com/tvastar/gotools/pkg/script"
+//
+//     // Test runs all the tests.
+//     func Test() script.Task {
+//         return script.Cmd("go", "test", "./...")
+//     }
+//
+// The files defining targets are compiled along with a generated
+// main function (which calls Main) into a runner binary.  The runner
+// binary is cached, keyed by the hash of the sources, including those
+// of local packages imported by the files.
+package gorun
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Tag is the build tag used to identify files defining targets.
+const Tag = "gorun"
+
+// version is included in the hash of runner binaries and should be
+// changed whenever the generated code changes.
+const version = "1"
+
+const scriptImportPath = "github.com/tvastar/gotools/pkg/script"
+
+// TargetInfo describes a target function.
+type TargetInfo struct {
+	// Name is the name of the function.
+	Name string
+
+	// Doc is the doc comment of the function.
+	Doc string
+}
+
+// Files returns the files defining targets. If path is a file, it is
+// returned as is. If path is a directory, the go files in it with the
+// "gorun" build tag are returned.
+func Files(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tagged := build.Default
+	tagged.BuildTags = []string{Tag}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" {
+			continue
+		}
+		withTag, err := tagged.MatchFile(path, name)
+		if err != nil {
+			return nil, err
+		}
+		withoutTag, err := build.Default.MatchFile(path, name)
+		if err != nil {
+			return nil, err
+		}
+		if withTag && !withoutTag {
+			files = append(files, filepath.Join(path, name))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("gorun: no files with the %q build tag in %s", Tag, path)
+	}
+	return files, nil
+}
+
+// Discover returns the targets defined in the files, sorted by
+// name.
+func Discover(files []string) ([]TargetInfo, error) {
+	var targets []TargetInfo
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		name := scriptImportName(f)
+		if name == "" {
+			continue
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && isTarget(fn, name) {
+				targets = append(targets, TargetInfo{fn.Name.Name, fn.Doc.Text()})
+			}
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Name < targets[j].Name
+	})
+	return targets, nil
+}
+
+// scriptImportName returns the name under which the script package
+// is imported, if at all.
+func scriptImportName(f *ast.File) string {
+	for _, imp := range f.Imports {
+		if path, err := strconv.Unquote(imp.Path.Value); err != nil || path != scriptImportPath {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return "script"
+	}
+	return ""
+}
+
+// isTarget checks if the function is of the form "func Name()
+// script.Task".
+func isTarget(fn *ast.FuncDecl, scriptName string) bool {
+	if fn.Recv != nil || !fn.Name.IsExported() || fn.Type.Params.NumFields() != 0 {
+		return false
+	}
+	results := fn.Type.Results
+	if results == nil || len(results.List) != 1 || len(results.List[0].Names) > 1 {
+		return false
+	}
+	sel, ok := results.List[0].Type.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Task" {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Name == scriptName
+}
+
+// Compile builds the runner binary for the files and returns its
+// path.  The binary is cached in cacheDir keyed by the hash of the
+// sources, including those of local packages imported by the files,
+// unless rebuild is set.
+//
+// gobin is the path of the "go" binary, which must be at least go
+// 1.16. All files must be in the same directory, which must be part
+// of a module requiring this package.
+func Compile(gobin string, files []string, targets []TargetInfo, cacheDir string, rebuild bool) (string, error) {
+	if len(files) == 0 {
+		return "", fmt.Errorf("gorun: no files")
+	}
+	dir := filepath.Dir(files[0])
+	for _, file := range files {
+		if filepath.Dir(file) != dir {
+			return "", fmt.Errorf("gorun: %s and %s are not in the same directory", files[0], file)
+		}
+	}
+
+	var main bytes.Buffer
+	if err := mainTemplate.Execute(&main, targets); err != nil {
+		return "", err
+	}
+
+	sources, err := localSources(gobin, dir, files)
+	if err != nil {
+		return "", err
+	}
+	key, err := hash(dir, append(files, sources...), main.Bytes())
+	if err != nil {
+		return "", err
+	}
+	binary := filepath.Join(cacheDir, key, "runner")
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	if _, err := os.Stat(binary); err == nil && !rebuild {
+		return binary, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(binary), 0777); err != nil { //nolint: gomnd
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(binary), "build")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	// the generated main is provided via an overlay rather than
+	// written next to the files.
+	overlay, err := writeOverlay(dir, tmp, main.Bytes())
+	if err != nil {
+		return "", err
+	}
+	output := filepath.Join(tmp, filepath.Base(binary))
+	args := []string{"build", "-tags", Tag, "-overlay", overlay, "-o", output}
+	for _, file := range files {
+		args = append(args, filepath.Base(file))
+	}
+	args = append(args, mainFile)
+	cmd := exec.Command(gobin, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("gorun: %v\n%s", err, out)
+	}
+	return binary, os.Rename(output, binary)
+}
+
+// mainFile is the name of the generated main file.
+const mainFile = "gorun_generated_main.go"
+
+// writeOverlay writes the generated main and an overlay file for
+// "go build" which places it in dir.  It returns the path of the
+// overlay file.
+func writeOverlay(dir, tmp string, main []byte) (string, error) {
+	abs, err := filepath.Abs(filepath.Join(dir, mainFile))
+	if err != nil {
+		return "", err
+	}
+	generated := filepath.Join(tmp, mainFile)
+	if err := ioutil.WriteFile(generated, main, 0666); err != nil { //nolint: gomnd
+		return "", err
+	}
+
+	data, err := json.Marshal(map[string]map[string]string{"Replace": {abs: generated}})
+	if err != nil {
+		return "", err
+	}
+	overlay := filepath.Join(tmp, "overlay.json")
+	return overlay, ioutil.WriteFile(overlay, data, 0666) //nolint: gomnd
+}
+
+// sourcesTemplate lists the files of packages in the main module or
+// in modules replaced by a local directory.  Other modules are
+// covered by go.sum.
+const sourcesTemplate = `{{if .Module}}{{if or .Module.Main (and .Module.Replace (not .Module.Replace.Version))}}` +
+	`{{range .GoFiles}}{{$.Dir}}/{{.}}
+{{end}}{{range .CgoFiles}}{{$.Dir}}/{{.}}
+{{end}}{{range .EmbedFiles}}{{$.Dir}}/{{.}}
+{{end}}{{end}}{{end}}`
+
+// localSources returns the source files of the local packages
+// imported by the files, directly or indirectly.
+func localSources(gobin, dir string, files []string) ([]string, error) {
+	args := []string{"list", "-deps", "-tags", Tag, "-f", sourcesTemplate}
+	for _, file := range files {
+		args = append(args, filepath.Base(file))
+	}
+	cmd := exec.Command(gobin, args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gorun: %v\n%s", err, stderr.Bytes())
+	}
+
+	var sources []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			sources = append(sources, filepath.FromSlash(line))
+		}
+	}
+	sort.Strings(sources)
+	return sources, nil
+}
+
+// hash computes the cache key of the runner binary.
+func hash(dir string, files []string, main []byte) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "gorun %s %s/%s\n", version, runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(h, "main %d\n", len(main))
+	h.Write(main)
+
+	for _, file := range append(files, moduleFiles(dir)...) {
+		if err := hashFile(h, file); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "file %q %d\n", file, len(data))
+	_, err = w.Write(data)
+	return err
+}
+
+// moduleFiles returns the go.mod and go.sum of the module containing
+// dir, if any.
+func moduleFiles(dir string) []string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			result := []string{filepath.Join(dir, "go.mod")}
+			if _, err := os.Stat(filepath.Join(dir, "go.sum")); err == nil {
+				result = append(result, filepath.Join(dir, "go.sum"))
+			}
+			return result
+		}
+		if filepath.Dir(dir) == dir {
+			return nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+var mainTemplate = template.Must(template.New("main").Parse(`// Code generated by gorun. DO NOT EDIT.
+
+// +build gorun
+
+package main
+
+import gorun_ "github.com/tvastar/gotools/pkg/gorun"
+
+func main() {
+	gorun_.Main(
+{{- range .}}
+		gorun_.Target{Name: {{printf "%q" .Name}}, Doc: {{printf "%q" .Doc}}, Task: {{.Name}}},
+{{- end}}
+	)
+}
+`)) //nolint: gochecknoglobals
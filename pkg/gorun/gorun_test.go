@@ -0,0 +1,191 @@
+package gorun_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tvastar/gotools/pkg/gorun"
+)
+
+func TestFiles(t *testing.T) {
+	files, err := gorun.Files("testdata/targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join("testdata", "targets", "other.go"),
+		filepath.Join("testdata", "targets", "targets.go"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Error("Unexpected", files)
+	}
+
+	file := filepath.Join("testdata", "targets", "untagged.go")
+	if files, err := gorun.Files(file); err != nil || !reflect.DeepEqual(files, []string{file}) {
+		t.Error("Unexpected", files, err)
+	}
+
+	if _, err := gorun.Files("."); err == nil {
+		t.Error("Unexpected success with no tagged files")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	files, err := gorun.Files("testdata/targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := gorun.Discover(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []gorun.TargetInfo{
+		{Name: "Fail", Doc: "Fail always fails.\n"},
+		{Name: "Hello", Doc: "Hello prints a greeting.\n\nIt is used by the tests.\n"},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Unexpected %#v", targets)
+	}
+
+	var buf bytes.Buffer
+	gorun.List(&buf, targets)
+	if x := buf.String(); x != "Targets:\n  fail   Fail always fails.\n  hello  Hello prints a greeting.\n" {
+		t.Errorf("Unexpected %q", x)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found", err)
+	}
+
+	files, err := gorun.Files("testdata/targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := gorun.Discover(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	binary, err := gorun.Compile(gobin, files, targets, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := gorun.Compile(gobin, files, targets, dir, false); err != nil || again != binary {
+		t.Error("Unexpected cache miss", again, err)
+	}
+	if matches, _ := filepath.Glob("testdata/targets/gorun_generated_*"); len(matches) != 0 {
+		t.Error("Generated files not removed", matches)
+	}
+
+	out, err := exec.Command(binary, "HELLO").Output()
+	if err != nil || string(out) != "hello\n" {
+		t.Errorf("Unexpected %q %v", out, err)
+	}
+
+	out, err = exec.Command(binary, "-n", "hello").Output()
+	if err != nil || !strings.Contains(string(out), "func") {
+		t.Errorf("Unexpected dry run %q %v", out, err)
+	}
+
+	if err := exec.Command(binary, "fail").Run(); err == nil {
+		t.Error("Unexpected success")
+	}
+	if err := exec.Command(binary, "missing").Run(); err == nil {
+		t.Error("Unexpected success")
+	}
+}
+
+func TestCompileLocalPackage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found", err)
+	}
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ioutil.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a module whose targets import a package of the module.
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/m\n\ngo 1.16\n\nrequire github.com/tvastar/gotools v0.0.0\n\nreplace github.com/tvastar/gotools => "+root+"\n")
+	write("go.sum", string(sum))
+	write("targets.go", `// +build gorun
+
+package main
+
+import (
+	"example.com/m/greeting"
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+// Hello prints a greeting.
+func Hello() script.Task {
+	return script.Echo(greeting.Text)
+}
+`)
+	greet := func(text string) {
+		write("greeting/greeting.go", "package greeting\n\n// Text is the greeting.\nconst Text = \""+text+"\"\n")
+	}
+
+	cache := t.TempDir()
+	compile := func() string {
+		files, err := gorun.Files(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets, err := gorun.Discover(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary, err := gorun.Compile(gobin, files, targets, cache, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command(binary, "hello").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	greet("hello")
+	if out := compile(); out != "hello\n" {
+		t.Errorf("Unexpected %q", out)
+	}
+	greet("bonjour")
+	if out := compile(); out != "bonjour\n" {
+		t.Errorf("Stale runner %q", out)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "gorun_generated_*")); len(matches) != 0 {
+		t.Error("Generated files written to the source directory", matches)
+	}
+}
@@ -0,0 +1,149 @@
+package gorun
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+// Target is a target function along with its name and doc.
+type Target struct {
+	Name string
+	Doc  string
+	Task func() script.Task
+}
+
+// Options control how targets are run.
+type Options struct {
+	// Verbose logs each target as it runs.
+	Verbose bool
+
+	// DryRun prints the plan of the targets without running them.
+	DryRun bool
+
+	// Parallel is the number of targets run in parallel.
+	Parallel int
+}
+
+// RegisterFlags registers the -v, -n and -j flags for the options,
+// along with the flags of script.DefaultCache.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Verbose, "v", o.Verbose, "log targets as they run")
+	fs.BoolVar(&o.DryRun, "n", o.DryRun, "print the plan without running anything")
+	fs.IntVar(&o.Parallel, "j", o.Parallel, "number of targets to run in parallel")
+	script.DefaultCache.RegisterFlags(fs)
+}
+
+// Args returns the command line flags for the options.
+func (o *Options) Args() []string {
+	return []string{
+		"-v=" + strconv.FormatBool(o.Verbose),
+		"-n=" + strconv.FormatBool(o.DryRun),
+		"-j=" + strconv.Itoa(o.Parallel),
+		"-nocache=" + strconv.FormatBool(script.DefaultCache.Disabled),
+		"-cachedir=" + script.DefaultCache.Dir,
+	}
+}
+
+// Main implements the main function of a runner binary: it parses
+// the command line for options and target names and runs the targets.
+// With no targets, it lists the available targets.
+func Main(targets ...Target) {
+	opts := Options{Parallel: 1}
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	opts.RegisterFlags(fs)
+	_ = fs.Parse(os.Args[1:])
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if fs.NArg() == 0 {
+		infos := make([]TargetInfo, len(targets))
+		for kk, t := range targets {
+			infos[kk] = TargetInfo{t.Name, t.Doc}
+		}
+		List(os.Stdout, infos)
+		return
+	}
+
+	if err := Run(ctx, opts, targets, fs.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// Run runs the named targets as per the options.
+func Run(ctx context.Context, opts Options, targets []Target, names []string) error {
+	tasks := make([]script.Task, len(names))
+	for kk, name := range names {
+		t, err := find(targets, name)
+		if err != nil {
+			return err
+		}
+		tasks[kk] = t.Task()
+		if opts.Verbose {
+			tasks[kk] = logged(t.Name, tasks[kk])
+		}
+	}
+
+	task := script.Sequence(tasks...)
+	if opts.Parallel > 1 {
+		task = script.ParallelWith(script.ParallelOptions{Limit: opts.Parallel}, tasks...)
+	}
+	if opts.DryRun {
+		return script.DryRun(ctx, os.Stdout, task)
+	}
+	return script.Run(ctx, task)
+}
+
+// find looks up a target by name, ignoring case.
+func find(targets []Target, name string) (Target, error) {
+	for _, t := range targets {
+		if strings.EqualFold(t.Name, name) {
+			return t, nil
+		}
+	}
+	return Target{}, fmt.Errorf("unknown target %q", name)
+}
+
+// logged logs the start and end of a task to stderr.
+func logged(name string, t script.Task) script.Task {
+	var start time.Time
+	before := script.Describe("# "+name, script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		start = time.Now()
+		fmt.Fprintf(os.Stderr, "gorun: %s: %v\n", name, t)
+		return nil
+	}))
+	after := script.Describe("# "+name+" done", script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		fmt.Fprintf(os.Stderr, "gorun: %s done (%v)\n", name, time.Since(start).Round(time.Millisecond))
+		return nil
+	}))
+	return script.Sequence(before, t, after)
+}
+
+// List prints the targets along with the first line of their doc.
+func List(w io.Writer, targets []TargetInfo) {
+	width := 0
+	for _, t := range targets {
+		if len(t.Name) > width {
+			width = len(t.Name)
+		}
+	}
+
+	fmt.Fprintln(w, "Targets:")
+	for _, t := range targets {
+		doc := strings.TrimSpace(t.Doc)
+		if idx := strings.IndexByte(doc, '\n'); idx != -1 {
+			doc = doc[:idx]
+		}
+		fmt.Fprintf(w, "  %-*s  %s\n", width, strings.ToLower(t.Name), doc)
+	}
+}
@@ -0,0 +1,47 @@
+package gorun_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/tvastar/gotools/pkg/gorun"
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func TestRun(t *testing.T) {
+	var ran []string
+	target := func(name string, err error) gorun.Target {
+		return gorun.Target{Name: name, Task: func() script.Task {
+			return script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+				ran = append(ran, name)
+				return err
+			})
+		}}
+	}
+	failed := errors.New("failed")
+	targets := []gorun.Target{target("Build", nil), target("Test", nil), target("Fail", failed)}
+
+	ctx := context.Background()
+	opts := gorun.Options{Parallel: 1}
+	if err := gorun.Run(ctx, opts, targets, []string{"test", "BUILD"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ran, []string{"Test", "Build"}) {
+		t.Error("Unexpected", ran)
+	}
+
+	ran = nil
+	if err := gorun.Run(ctx, opts, targets, []string{"fail", "build"}); !errors.Is(err, failed) {
+		t.Error("Unexpected", err)
+	}
+	if !reflect.DeepEqual(ran, []string{"Fail"}) {
+		t.Error("Unexpected", ran)
+	}
+
+	if err := gorun.Run(ctx, opts, targets, []string{"missing"}); err == nil {
+		t.Error("Unexpected success")
+	}
+}
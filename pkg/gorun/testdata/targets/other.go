@@ -0,0 +1,8 @@
+// +build gorun
+
+package main
+
+// Other is not a target.
+func Other() string {
+	return "other"
+}
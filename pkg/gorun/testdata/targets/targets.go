@@ -0,0 +1,35 @@
+// +build gorun
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	s "github.com/tvastar/gotools/pkg/script"
+)
+
+// Hello prints a greeting.
+//
+// It is used by the tests.
+func Hello() s.Task {
+	return s.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		_, err := fmt.Fprintln(w, "hello")
+		return err
+	})
+}
+
+// Fail always fails.
+func Fail() s.Task {
+	return s.Error(fmt.Errorf("failed"))
+}
+
+func private() s.Task {
+	return Hello()
+}
+
+// WithArgs is not a target.
+func WithArgs(name string) s.Task {
+	return Hello()
+}
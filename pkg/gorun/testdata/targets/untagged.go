@@ -0,0 +1,8 @@
+package main
+
+import "github.com/tvastar/gotools/pkg/script"
+
+// Untagged is not in a gorun file.
+func Untagged() script.Task {
+	return script.Cmd("true")
+}
@@ -0,0 +1,324 @@
+package script
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrNoMatch is returned by Grep when no lines match.
+var ErrNoMatch = errors.New("no match") //nolint: gochecknoglobals
+
+// Echo writes the args separated by spaces and followed by a newline,
+// like "echo".
+func Echo(args ...string) Task {
+	return builtin("echo", args, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		_, err := io.WriteString(w, strings.Join(args, " ")+"\n")
+		return err
+	})
+}
+
+// Cat writes the contents of the files in order, like "cat". With no
+// files or with the file "-", stdin is copied. Relative paths are
+// resolved against the directory set via Dir.
+func Cat(paths ...string) Task {
+	return builtin("cat", paths, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		if len(paths) == 0 {
+			return copyReader(w, r)
+		}
+		for _, path := range paths {
+			if path == "-" {
+				if err := copyReader(w, r); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := catFile(w, environFrom(ctx).path(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Grep writes the lines of stdin matching the regular expression,
+// like "grep -E". It fails with ErrNoMatch if no lines match.
+func Grep(pattern string) Task {
+	return grep([]string{pattern}, pattern, false)
+}
+
+// GrepInvert writes the lines of stdin not matching the regular
+// expression, like "grep -v -E". It fails with ErrNoMatch if all
+// lines match.
+func GrepInvert(pattern string) Task {
+	return grep([]string{"-v", pattern}, pattern, true)
+}
+
+func grep(args []string, pattern string, invert bool) Task {
+	return builtin("grep -E", args, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		matched := false
+		err = eachLine(ctx, r, func(line string) error {
+			if re.MatchString(line) == invert {
+				return nil
+			}
+			matched = true
+			return writeLine(w, line)
+		})
+		if err == nil && !matched {
+			err = ErrNoMatch
+		}
+		return err
+	})
+}
+
+// Replace replaces all matches of the regular expression in each line
+// of stdin, like "sed -E 's/pattern/replacement/g'". The replacement
+// can refer to submatches as with regexp.Regexp.Expand, such as $1.
+func Replace(pattern, replacement string) Task {
+	sed := "s/" + pattern + "/" + replacement + "/g"
+	return builtin("sed -E", []string{sed}, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		return eachLine(ctx, r, func(line string) error {
+			return writeLine(w, re.ReplaceAllString(line, replacement))
+		})
+	})
+}
+
+// Head writes the first n lines of stdin, like "head -n".
+//
+// The rest of stdin is not read: within a Pipe, earlier tasks are
+// stopped once they write more than Head reads.
+func Head(n int) Task {
+	return builtin("head", []string{"-n", strconv.Itoa(n)}, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		if n <= 0 {
+			return nil
+		}
+		count := 0
+		err := eachLine(ctx, r, func(line string) error {
+			if err := writeLine(w, line); err != nil {
+				return err
+			}
+			if count++; count == n {
+				return errHeadDone
+			}
+			return nil
+		})
+		if err == errHeadDone {
+			return nil
+		}
+		return err
+	})
+}
+
+var errHeadDone = errors.New("head done") //nolint: gochecknoglobals
+
+// Tail writes the last n lines of stdin, like "tail -n".
+func Tail(n int) Task {
+	return builtin("tail", []string{"-n", strconv.Itoa(n)}, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		var lines []string
+		err := eachLine(ctx, r, func(line string) error {
+			if lines = append(lines, line); len(lines) > n {
+				lines = lines[1:]
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return writeLines(w, lines)
+	})
+}
+
+// Sort writes the lines of stdin in sorted order, like "LC_ALL=C
+// sort".
+func Sort() Task {
+	return builtin("sort", nil, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		lines, err := readLines(ctx, r)
+		if err != nil {
+			return err
+		}
+		sort.Strings(lines)
+		return writeLines(w, lines)
+	})
+}
+
+// Uniq writes the lines of stdin, skipping lines which repeat the
+// previous line, like "uniq".
+func Uniq() Task {
+	return builtin("uniq", nil, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		first, last := true, ""
+		return eachLine(ctx, r, func(line string) error {
+			if !first && line == last {
+				return nil
+			}
+			first, last = false, line
+			return writeLine(w, line)
+		})
+	})
+}
+
+// Wc writes the number of lines, words and bytes in stdin separated
+// by spaces, like "wc" but without padding.
+func Wc() Task {
+	return builtin("wc", nil, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		var lines, words, bytes int
+		inWord := false
+		br := bufio.NewReader(r)
+		for {
+			ch, size, err := br.ReadRune()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			bytes += size
+			if ch == '\n' {
+				lines++
+			}
+			if unicode.IsSpace(ch) {
+				inWord = false
+			} else if !inWord {
+				inWord = true
+				words++
+			}
+		}
+		_, err := fmt.Fprintf(w, "%d %d %d\n", lines, words, bytes)
+		return err
+	})
+}
+
+// WcLines writes the number of lines in stdin, like "wc -l" but
+// without padding.
+func WcLines() Task {
+	return builtin("wc", []string{"-l"}, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		count := 0
+		err := eachLine(ctx, r, func(string) error {
+			count++
+			return nil
+		})
+		if err == nil {
+			_, err = fmt.Fprintf(w, "%d\n", count)
+		}
+		return err
+	})
+}
+
+// Tee copies stdin to stdout and to each of the files, like "tee".
+// The files are truncated first and relative paths are resolved
+// against the directory set via Dir.
+func Tee(paths ...string) Task {
+	return builtin("tee", paths, func(ctx context.Context, r io.Reader, w io.Writer) error {
+		writers := []io.Writer{w}
+		for _, path := range paths {
+			f, err := os.Create(environFrom(ctx).path(path))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			writers = append(writers, f)
+		}
+		if err := copyReader(io.MultiWriter(writers...), r); err != nil {
+			return err
+		}
+		for _, w := range writers[1:] {
+			if err := w.(*os.File).Close(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// builtin creates a Func task described as the equivalent shell
+// command.
+func builtin(name string, args []string, f func(ctx context.Context, r io.Reader, w io.Writer) error) Task {
+	words := []string{name}
+	for _, arg := range args {
+		words = append(words, shQuote(arg))
+	}
+	return Describe(strings.Join(words, " "), Func(f))
+}
+
+// eachLine calls fn with each line of r, without the line ending.
+// The final line need not end with a newline.
+func eachLine(ctx context.Context, r io.Reader, fn func(line string) error) error {
+	if r == nil {
+		return nil
+	}
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readLines(ctx context.Context, r io.Reader) ([]string, error) {
+	var lines []string
+	err := eachLine(ctx, r, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	return lines, err
+}
+
+func writeLine(w io.Writer, line string) error {
+	_, err := io.WriteString(w, line+"\n")
+	return err
+}
+
+func writeLines(w io.Writer, lines []string) error {
+	for _, line := range lines {
+		if err := writeLine(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyReader(w io.Writer, r io.Reader) error {
+	if r == nil {
+		return nil
+	}
+	_, err := io.Copy(w, r)
+	return err
+}
+
+func catFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
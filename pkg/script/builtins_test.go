@@ -0,0 +1,132 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleGrep() {
+	out, err := script.Output(context.Background(), script.Pipe(
+		script.Echo("b 2\na 1\nc 3\na 1\nd 4"),
+		script.Grep("^[abc] "),
+		script.Sort(),
+		script.Uniq(),
+		script.Replace(`^(\w) (\d)$`, "$2=$1"),
+		script.Head(2),
+	))
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	fmt.Print(out)
+
+	// Output:
+	// 1=a
+	// 2=b
+}
+
+func ExampleWc() {
+	out, err := script.Output(context.Background(), script.Pipe(
+		script.Echo("hello world\nhow are you"),
+		script.Tail(1),
+		script.Wc(),
+	))
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	fmt.Print(out)
+
+	// Output: 1 3 12
+}
+
+func ExampleCat() {
+	task := script.Pipe(script.Cat("go.mod", "-"), script.Grep("^module"), script.WcLines())
+	if err := script.DryRunShell(context.Background(), os.Stdout, task); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output: cat go.mod - | grep -E '^module' | wc -l
+}
+
+func TestGrepNoMatch(t *testing.T) {
+	ctx := context.Background()
+	out, err := script.Output(ctx, script.Pipe(script.Echo("a\nb"), script.Grep("c")))
+	if out != "" || !errors.Is(err, script.ErrNoMatch) {
+		t.Errorf("Unexpected %q %v", out, err)
+	}
+
+	out, err = script.Output(ctx, script.Pipe(script.Echo("a\nb"), script.GrepInvert("a")))
+	if out != "b\n" || err != nil {
+		t.Errorf("Unexpected %q %v", out, err)
+	}
+
+	if _, err := script.Output(ctx, script.Pipe(script.Echo("a"), script.Grep("("))); err == nil {
+		t.Error("Unexpected success with invalid regexp")
+	}
+}
+
+func TestCatTee(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+
+	out, err := script.Output(ctx, script.Pipe(script.Echo("hello"), script.Tee(a, b)))
+	if out != "hello\n" || err != nil {
+		t.Fatalf("Unexpected %q %v", out, err)
+	}
+	if data, err := ioutil.ReadFile(b); string(data) != "hello\n" || err != nil {
+		t.Errorf("Unexpected %q %v", data, err)
+	}
+
+	cat := script.Cat(a, "-", b).Stdin(strings.NewReader("world\n"))
+	if out, err := script.Output(ctx, cat); out != "hello\nworld\nhello\n" || err != nil {
+		t.Errorf("Unexpected %q %v", out, err)
+	}
+
+	if out, err := script.Output(ctx, script.Dir(dir, script.Cat("a"))); out != "hello\n" || err != nil {
+		t.Errorf("Unexpected %q %v", out, err)
+	}
+
+	if _, err := script.Output(ctx, script.Cat(filepath.Join(dir, "missing"))); !os.IsNotExist(err) {
+		t.Error("Unexpected", err)
+	}
+}
+
+func TestHeadLargeInput(t *testing.T) {
+	lines := strings.Repeat("line\n", 100000)
+	out, err := script.Output(context.Background(), script.Pipe(script.Echo(lines), script.Head(1)))
+	if out != "line\n" || err != nil {
+		t.Errorf("Unexpected %q %v", out, err)
+	}
+}
+
+func TestHeadInfiniteInput(t *testing.T) {
+	forever := script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		for {
+			if _, err := fmt.Fprintln(w, "y"); err != nil {
+				return err
+			}
+		}
+	})
+	producers := map[string]script.Task{
+		"cmd":  script.Cmd("yes"),
+		"func": forever,
+	}
+	for name, producer := range producers {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		out, err := script.Output(ctx, script.Pipe(producer, script.Cat(), script.Head(2)))
+		cancel()
+		if out != "y\ny\n" || err != nil {
+			t.Errorf("%s: Unexpected %q %v", name, out, err)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// Cache stores the outputs of tasks keyed by the contents of their
+// inputs, so that tasks can be skipped even when file timestamps are
+// not reliable (such as after switching git branches).
+type Cache struct {
+	// Dir is the directory where outputs are stored.
+	Dir string
+
+	// MaxSize is the maximum total size in bytes of the cache.
+	// Least recently used entries are evicted beyond this. Zero
+	// means no limit.
+	MaxSize int64
+
+	// Disabled bypasses the cache: tasks are always run and their
+	// outputs are not stored.
+	Disabled bool
+
+	// EnvKeys lists the environment variables which are part of
+	// the cache key.  Entries can be patterns, such as "GO*", as
+	// supported by path.Match.  Nil means DefaultEnvKeys.
+	EnvKeys []string
+}
+
+// DefaultEnvKeys are the environment variables which are part of the
+// cache key by default.  Variables which often change between runs,
+// such as the terminal or ssh session, would otherwise cause misses.
+var DefaultEnvKeys = []string{"PATH", "HOME", "GO*", "CGO_*"} //nolint: gochecknoglobals
+
+// DefaultCache is the cache used by Cached. It is stored in the user
+// cache directory.
+var DefaultCache = &Cache{Dir: defaultCacheDir()} //nolint: gochecknoglobals
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "gotools", "script")
+}
+
+// RegisterFlags registers the -nocache and -cachedir flags for
+// controlling the cache from the command line.
+func (c *Cache) RegisterFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.Disabled, "nocache", c.Disabled, "bypass the task output cache")
+	fs.StringVar(&c.Dir, "cachedir", c.Dir, "directory of the task output cache")
+}
+
+// Cached is like Cache.Cached using the DefaultCache.
+func Cached(inputs, outputs []string, t Task) Task {
+	return DefaultCache.Cached(inputs, outputs, t)
+}
+
+// Cached runs the task unless the cache has an entry for the same
+// inputs, in which case the outputs (and stdout) of the task are
+// restored from the cache instead.
+//
+// The cache key is a hash of the contents of the files matching the
+// input glob patterns, the task's description (see String) and the
+// environment of the task (see Cache.EnvKeys).  Input provided via
+// Stdin is not part of the key.
+//
+// As Func tasks cannot describe themselves, they must be wrapped
+// with Describe.  The task fails otherwise.
+//
+// Relative paths are resolved against the working directory of the
+// task (see Dir). All outputs must be created by the task.
+func (c *Cache) Cached(inputs, outputs []string, t Task) Task {
+	return &cached{cache: c, inputs: inputs, outputs: outputs, task: t, stdout: os.Stdout}
+}
+
+type cached struct {
+	cache           *Cache
+	inputs, outputs []string
+	task            Task
+	stdout          io.Writer
+
+	env     environ
+	key     string
+	hit     bool
+	running Task
+	buf     bytes.Buffer
+	err     error
+}
+
+func (c *cached) Start(ctx context.Context) error {
+	c.env = environFrom(ctx)
+	c.hit, c.running, c.err = false, nil, nil
+	if c.cache.Disabled {
+		c.running = c.task.Stdout(c.stdout)
+		return c.running.Start(ctx)
+	}
+
+	if c.key, c.err = c.hash(); c.err != nil {
+		return c.err
+	}
+	if c.hit = c.cache.has(c.key); c.hit {
+		return nil
+	}
+
+	c.buf.Reset()
+	c.running = c.task.Stdout(io.MultiWriter(c.stdout, &c.buf))
+	return c.running.Start(ctx)
+}
+
+func (c *cached) Wait(ctx context.Context) error {
+	switch {
+	case c.err != nil:
+		return c.err
+	case c.hit:
+		return c.cache.restore(c.key, c.paths(), c.stdout)
+	case c.running == nil:
+		return nil
+	}
+
+	if err := c.running.Wait(ctx); err != nil || c.cache.Disabled {
+		return err
+	}
+	return c.cache.store(c.key, c.paths(), c.buf.Bytes())
+}
+
+func (c *cached) paths() []string {
+	result := make([]string, len(c.outputs))
+	for kk, output := range c.outputs {
+		result[kk] = c.env.path(output)
+	}
+	return result
+}
+
+// hash computes the cache key.
+func (c *cached) hash() (string, error) {
+	p, err := planOf(context.Background(), c.task, false)
+	if err != nil {
+		return "", err
+	}
+	if p.isOpaque() {
+		return "", errors.New("script: cached tasks with Func must be described via Describe")
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "task %q\n", p.shell)
+	fmt.Fprintf(h, "env %q\n", c.environ())
+	fmt.Fprintf(h, "outputs %q\n", c.outputs)
+
+	for _, input := range c.inputs {
+		matches, err := doublestar.Glob(c.env.path(input))
+		if err != nil {
+			return "", err
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if err := hashFile(h, c.env, match); err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// environ returns the sorted environment variables which are part
+// of the cache key.
+func (c *cached) environ() []string {
+	patterns := c.cache.EnvKeys
+	if patterns == nil {
+		patterns = DefaultEnvKeys
+	}
+
+	var result []string
+	for _, v := range c.env.environ() {
+		key := strings.SplitN(v, "=", 2)[0] //nolint: gomnd
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, key); ok {
+				result = append(result, v)
+				break
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func hashFile(w io.Writer, env environ, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return err
+	}
+
+	name := path
+	if env.dir != "" {
+		if rel, err := filepath.Rel(env.dir, path); err == nil {
+			name = rel
+		}
+	}
+	fmt.Fprintf(w, "input %q %d\n", name, fi.Size())
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (c *cached) instance() Task {
+	return &cached{cache: c.cache, inputs: c.inputs, outputs: c.outputs, task: instance(c.task), stdout: c.stdout}
+}
+
+func (c *cached) Stdin(r io.Reader) Task {
+	return &cached{cache: c.cache, inputs: c.inputs, outputs: c.outputs, task: c.task.Stdin(r), stdout: c.stdout}
+}
+
+func (c *cached) Stdout(w io.Writer) Task {
+	return &cached{cache: c.cache, inputs: c.inputs, outputs: c.outputs, task: c.task, stdout: w}
+}
+
+func (c *cached) Stderr(w io.Writer) Task {
+	return &cached{cache: c.cache, inputs: c.inputs, outputs: c.outputs, task: c.task.Stderr(w), stdout: c.stdout}
+}
+
+func (c *cached) plan(ctx context.Context, eval bool) (*plan, error) {
+	p, err := planOf(ctx, c.task, eval)
+	if err != nil {
+		return nil, err
+	}
+	return &plan{label: "cached", shell: p.shell, level: p.level, children: []*plan{p}}, nil
+}
+
+func (c *cached) String() string {
+	return describe(c)
+}
+
+// entry is the directory of a cache entry. It holds the outputs
+// named by their index and the stdout.
+func (c *Cache) entry(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+func (c *Cache) has(key string) bool {
+	_, err := os.Stat(c.entry(key))
+	return err == nil
+}
+
+func (c *Cache) restore(key string, outputs []string, stdout io.Writer) error {
+	entry := c.entry(key)
+	for kk, output := range outputs {
+		if err := os.MkdirAll(filepath.Dir(output), 0777); err != nil { //nolint: gomnd
+			return err
+		}
+		if err := copyFile(filepath.Join(entry, strconv.Itoa(kk)), output); err != nil {
+			return err
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(entry, "stdout"))
+	if err == nil {
+		_, err = stdout.Write(data)
+	}
+
+	// update the entry time for LRU eviction.
+	now := time.Now()
+	_ = os.Chtimes(entry, now, now)
+	return err
+}
+
+func (c *Cache) store(key string, outputs []string, stdout []byte) error {
+	if err := os.MkdirAll(filepath.Dir(c.entry(key)), 0777); err != nil { //nolint: gomnd
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(c.entry(key)), "tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	for kk, output := range outputs {
+		if err := copyFile(output, filepath.Join(tmp, strconv.Itoa(kk))); err != nil {
+			return fmt.Errorf("script: output %s: %w", output, err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "stdout"), stdout, 0666); err != nil { //nolint: gomnd
+		return err
+	}
+	if err := os.Rename(tmp, c.entry(key)); err != nil && !c.has(key) {
+		return err
+	}
+	return c.evict()
+}
+
+// evict removes the least recently used entries till the cache is
+// within its size limit.
+func (c *Cache) evict() error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	type entry struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var entries []entry
+	var total int64
+	dirs, err := filepath.Glob(filepath.Join(c.Dir, "*", "*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		fi, err := os.Stat(dir)
+		if err != nil || !fi.IsDir() {
+			continue
+		}
+		e := entry{path: dir, used: fi.ModTime()}
+		files, _ := ioutil.ReadDir(dir)
+		for _, f := range files {
+			e.size += f.Size()
+		}
+		entries = append(entries, e)
+		total += e.size
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].used.Before(entries[j].used)
+	})
+	for _, e := range entries {
+		if total <= c.MaxSize {
+			break
+		}
+		if err := os.RemoveAll(e.path); err != nil {
+			return err
+		}
+		total -= e.size
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
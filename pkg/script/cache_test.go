@@ -0,0 +1,179 @@
+package script_test
+
+import (
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func TestCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := &script.Cache{Dir: filepath.Join(dir, "cache")}
+	work := filepath.Join(dir, "work")
+	if err := os.MkdirAll(work, 0777); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(work, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		data, _ := ioutil.ReadFile(filepath.Join(work, name))
+		return string(data)
+	}
+
+	runs := 0
+	task := script.Dir(work, cache.Cached(
+		[]string{"*.in"},
+		[]string{"gen/out.txt"},
+		script.Sequence(
+			script.Describe("count", script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+				runs++
+				return nil
+			})),
+			script.Sh("mkdir -p gen && cat a.in > gen/out.txt && echo generated"),
+		),
+	))
+	run := func() string {
+		out, err := script.Output(context.Background(), task)
+		if err != nil {
+			t.Fatal("run failed", err)
+		}
+		return out
+	}
+
+	write("a.in", "hello")
+	if out := run(); out != "generated\n" || runs != 1 || read("gen/out.txt") != "hello" {
+		t.Error("unexpected first run", out, runs)
+	}
+
+	// hit: outputs and stdout are restored.
+	os.RemoveAll(filepath.Join(work, "gen"))
+	if out := run(); out != "generated\n" || runs != 1 || read("gen/out.txt") != "hello" {
+		t.Error("unexpected cached run", out, runs)
+	}
+
+	// miss: input changed.
+	write("a.in", "world")
+	if run(); runs != 2 || read("gen/out.txt") != "world" {
+		t.Error("unexpected run after change", runs)
+	}
+
+	// back to the old input: hit.
+	write("a.in", "hello")
+	if run(); runs != 2 || read("gen/out.txt") != "hello" {
+		t.Error("unexpected run after revert", runs)
+	}
+
+	// bypass via flags.
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cache.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-nocache"}); err != nil {
+		t.Fatal(err)
+	}
+	if run(); runs != 3 {
+		t.Error("unexpected run with cache disabled", runs)
+	}
+}
+
+func TestCachedEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := &script.Cache{Dir: filepath.Join(dir, "cache"), MaxSize: 10}
+	for _, word := range []string{"hello", "world", "again"} {
+		task := script.Dir(dir, cache.Cached(nil, nil, script.Cmd("echo", word)))
+		if _, err := script.Output(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := filepath.Glob(filepath.Join(dir, "cache", "*", "*"))
+	if err != nil || len(entries) != 1 {
+		t.Error("unexpected entries", entries, err)
+	}
+}
+
+func TestCachedMissingOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := &script.Cache{Dir: dir}
+	task := cache.Cached(nil, []string{filepath.Join(dir, "missing")}, script.Cmd("true"))
+	if err := script.Run(context.Background(), task); err == nil {
+		t.Error("unexpected success")
+	}
+}
+
+func TestCachedKey(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	runs := 0
+	count := script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		runs++
+		return nil
+	})
+	run := func(cache *script.Cache, task script.Task) {
+		if err := script.Run(ctx, cache.Cached(nil, nil, task)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the default keys of the process environment are part of the key.
+	cache := &script.Cache{Dir: filepath.Join(dir, "default")}
+	task := script.Describe("count", count)
+	os.Setenv("GOSCRIPT_CACHE_TEST", "a")
+	defer os.Unsetenv("GOSCRIPT_CACHE_TEST")
+	run(cache, task)
+	run(cache, task)
+	os.Setenv("GOSCRIPT_CACHE_TEST", "b")
+	if run(cache, task); runs != 2 {
+		t.Error("unexpected runs after env change", runs)
+	}
+
+	// other variables are not.
+	os.Setenv("SCRIPT_CACHE_TEST", "a")
+	defer os.Unsetenv("SCRIPT_CACHE_TEST")
+	if run(cache, task); runs != 2 {
+		t.Error("unexpected runs after unrelated env change", runs)
+	}
+
+	// unless it is not one of the keys.
+	cache = &script.Cache{Dir: filepath.Join(dir, "keys"), EnvKeys: []string{"SCRIPT_CACHE_KEY"}}
+	os.Setenv("SCRIPT_CACHE_KEY", "a")
+	defer os.Unsetenv("SCRIPT_CACHE_KEY")
+	run(cache, task)
+	os.Setenv("SCRIPT_CACHE_TEST", "c")
+	if run(cache, task); runs != 3 {
+		t.Error("unexpected runs with env keys", runs)
+	}
+	os.Setenv("SCRIPT_CACHE_KEY", "b")
+	if run(cache, task); runs != 4 {
+		t.Error("unexpected runs after key change", runs)
+	}
+
+	// Func tasks must be described.
+	err := script.Run(ctx, cache.Cached(nil, nil, script.Sequence(script.Cmd("true"), count)))
+	if err == nil || runs != 4 {
+		t.Error("unexpected undescribed Func", err, runs)
+	}
+}
@@ -3,8 +3,11 @@ package script
 import (
 	"context"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 )
 
 type cmd struct {
@@ -15,24 +18,139 @@ type cmd struct {
 	stdout  io.Writer
 	stderr  io.Writer
 	cmd     *exec.Cmd
+	tail    *tailBuffer
+	start   time.Time
+	cancel  context.CancelFunc
+	exited  chan struct{}
+	exit    *sync.Once
+	stopped chan struct{}
 }
 
+// Start runs the command in its own process group.  When the context
+// is cancelled, the whole group is sent SIGTERM and then SIGKILL if
+// it has not exited within the grace period (see GracePeriod).
+//
+// If stdin is the terminal of the program, the group of the command
+// is placed in the foreground of the terminal while it runs, like a
+// shell does, so that the command can read from the terminal and
+// receive Ctrl-C directly.
+//
+// Otherwise, signals from the terminal reach only the Go program.
+// Programs should cancel the context on interrupt (for example, via
+// signal.NotifyContext) so that the commands are stopped too.
 func (c *cmd) Start(ctx context.Context) error {
-	c.cmd = exec.CommandContext(ctx, c.program, c.args...)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.cmd = exec.Command(c.program, c.args...)
+	setProcessGroup(c.cmd, c.stdin)
 	if c.logger != nil {
 		c.logger.Println(">", strings.Join(c.cmd.Args, " "))
 	}
+	env := environFrom(ctx)
+	c.cmd.Dir = env.dir
+	c.cmd.Env = env.env
 	c.cmd.Stdin = c.stdin
 	c.cmd.Stdout = c.stdout
-	c.cmd.Stderr = c.stderr
-	return c.cmd.Start()
+	c.cmd.Stderr = c.stderrWriter()
+	c.start = time.Now()
+	if err := c.cmd.Start(); err != nil {
+		releaseTerminal(c.cmd)
+		return err
+	}
+
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.exited, c.exit, c.stopped = make(chan struct{}), &sync.Once{}, make(chan struct{})
+	go c.cancelOnDone(ctx, env.gracePeriod())
+	return nil
 }
 
+// stderrWriter returns the stderr of the command, recording its tail
+// for ExitError only if the command would use a pipe for it anyway.
+//
+// Files are passed through so that no copying goroutine keeps Wait
+// waiting on background descendants which inherit stderr.  A stderr
+// which is the same as stdout is passed through so that both share
+// a single pipe, preserving the order of the output as with 2>&1.
+func (c *cmd) stderrWriter() io.Writer {
+	c.tail = &tailBuffer{max: maxStderrTail}
+	if _, ok := c.stderr.(*os.File); ok || c.stderr == nil || sameWriter(c.stderr, c.stdout) {
+		return c.stderr
+	}
+	return io.MultiWriter(c.stderr, c.tail)
+}
+
+// sameWriter is like w1 == w2 but does not panic if the writers are
+// not comparable.
+func sameWriter(w1, w2 io.Writer) (same bool) {
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return w1 == w2
+}
+
+// cancelOnDone stops the process group when the context is done.
+// Wait returns only after this is done, so no processes of the group
+// are left running.
+func (c *cmd) cancelOnDone(ctx context.Context, grace time.Duration) {
+	defer close(c.stopped)
+
+	select {
+	case <-c.exited:
+		return
+	case <-ctx.Done():
+	}
+
+	terminateGroup(c.cmd)
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	// the command may exit before its descendants do.
+	ticker := time.NewTicker(10 * time.Millisecond) //nolint: gomnd
+	defer ticker.Stop()
+	exited := c.exited
+	for {
+		select {
+		case <-timer.C:
+			killGroup(c.cmd)
+			return
+		case <-exited:
+			exited = nil
+		case <-ticker.C:
+		}
+		if exited == nil && !groupAlive(c.cmd) {
+			return
+		}
+	}
+}
+
+// Wait stops the command as in Start if the context is done. The
+// returned ExitError then wraps ctx.Err().
 func (c cmd) Wait(ctx context.Context) error {
-	if c.cmd == nil {
+	if c.cmd == nil || c.exited == nil {
 		return nil
 	}
-	return c.cmd.Wait()
+	stop := propagate(ctx, c.cancel)
+	err := c.cmd.Wait()
+	releaseTerminal(c.cmd)
+	c.exit.Do(func() { close(c.exited) })
+	<-c.stopped
+	stop()
+	c.cancel()
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return newExitError(c.cmd, time.Since(c.start), c.tail.Bytes(), err)
+	}
+	return nil
+}
+
+func (c cmd) instance() Task {
+	return &cmd{logger: c.logger, program: c.program, args: c.args, stdin: c.stdin, stdout: c.stdout, stderr: c.stderr}
 }
 
 func (c cmd) Stdin(r io.Reader) Task {
@@ -46,3 +164,23 @@ func (c cmd) Stdout(w io.Writer) Task {
 	result.stdout = w
 	return &result
 }
+
+func (c cmd) Stderr(w io.Writer) Task {
+	result := c
+	result.stderr = w
+	return &result
+}
+
+func (c *cmd) plan(ctx context.Context, eval bool) (*plan, error) {
+	words := make([]string, len(c.args)+1)
+	words[0] = shQuote(c.program)
+	for kk, arg := range c.args {
+		words[kk+1] = shQuote(arg)
+	}
+	s := strings.Join(words, " ")
+	return &plan{label: s, shell: s}, nil
+}
+
+func (c *cmd) String() string {
+	return describe(c)
+}
@@ -2,6 +2,7 @@ package script
 
 import (
 	"context"
+	"fmt"
 	"io"
 )
 
@@ -26,6 +27,9 @@ func (c *conditional) Wait(ctx context.Context) error {
 	if c.err == nil {
 		c.err = c.cond.Wait(ctx)
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if c.err != nil {
 		result = c.failure
 	}
@@ -36,6 +40,11 @@ func (c *conditional) Wait(ctx context.Context) error {
 	return Run(ctx, result)
 }
 
+func (c *conditional) instance() Task {
+	// the branches are run via Run which creates their instances.
+	return &conditional{cond: instance(c.cond), success: c.success, failure: c.failure}
+}
+
 func (c *conditional) Stdin(r io.Reader) Task {
 	withStdin := func(t Task) Task {
 		if t != nil {
@@ -65,3 +74,86 @@ func (c *conditional) Stdout(w io.Writer) Task {
 		failure: withStdout(c.failure),
 	}
 }
+
+func (c *conditional) Stderr(w io.Writer) Task {
+	withStderr := func(t Task) Task {
+		if t != nil {
+			return t.Stderr(w)
+		}
+		return t
+	}
+
+	return &conditional{
+		cond:    c.cond.Stderr(w),
+		success: withStderr(c.success),
+		failure: withStderr(c.failure),
+	}
+}
+
+func (c *conditional) plan(ctx context.Context, eval bool) (*plan, error) {
+	if _, ok := c.cond.(safe); ok && eval {
+		return c.evaluate(ctx)
+	}
+
+	cond, err := planOf(ctx, c.cond, eval)
+	if err != nil {
+		return nil, err
+	}
+	result := &plan{label: "if", children: []*plan{cond}}
+
+	var success, failure *plan
+	if c.success != nil {
+		if success, err = planOf(ctx, c.success, eval); err != nil {
+			return nil, err
+		}
+		result.children = append(result.children, &plan{label: "then", children: []*plan{success}})
+	}
+	if c.failure != nil {
+		if failure, err = planOf(ctx, c.failure, eval); err != nil {
+			return nil, err
+		}
+		result.children = append(result.children, &plan{label: "else", children: []*plan{failure}})
+	}
+
+	switch {
+	case success == nil && failure == nil:
+		result.shell = cond.shell
+		result.level = cond.level
+	case failure == nil:
+		result.shell = joined("", " && ", shAndOr, []*plan{cond, success}).shell
+		result.level = shAndOr
+	case success == nil:
+		result.shell = joined("", " || ", shAndOr, []*plan{cond, failure}).shell
+		result.level = shAndOr
+	default:
+		result.shell = "if " + cond.shell + "; then " + success.shell + "; else " + failure.shell + "; fi"
+	}
+	return result, nil
+}
+
+// evaluate runs the condition and plans the chosen branch.
+func (c *conditional) evaluate(ctx context.Context) (*plan, error) {
+	outcome, branch := "succeeded", c.success
+	if Run(ctx, c.cond) != nil {
+		outcome, branch = "failed", c.failure
+	}
+
+	label := fmt.Sprintf("# %s %s", describe(c.cond), outcome)
+	if branch == nil {
+		shell := "true"
+		if outcome == "failed" {
+			shell = "false"
+		}
+		return &plan{label: label, shell: shell}, nil
+	}
+
+	p, err := planOf(ctx, branch, true)
+	if err != nil {
+		return nil, err
+	}
+	return &plan{label: label, shell: p.shell, level: p.level, children: []*plan{p}}, nil
+}
+
+func (c *conditional) String() string {
+	return describe(c)
+}
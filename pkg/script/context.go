@@ -0,0 +1,109 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// background runs a function in a goroutine. It is used by tasks
+// which do their work in the background between Start and Wait.
+type background struct {
+	cancel context.CancelFunc
+	done   chan error
+}
+
+func runBackground(ctx context.Context, f func(ctx context.Context) error) *background {
+	ctx, cancel := context.WithCancel(ctx)
+	b := &background{cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		var err error
+		defer func() {
+			b.done <- err
+		}()
+		err = f(ctx)
+	}()
+	return b
+}
+
+// wait waits for the function to complete.
+//
+// If ctx is done first, the context of the function is cancelled and
+// ctx.Err() is returned.  This happens once the function returns,
+// unless abandon is set: this is used with functions which may not
+// respect cancellation, such as those provided to Func.
+func (b *background) wait(ctx context.Context, abandon bool) error {
+	defer b.cancel()
+
+	select {
+	case err := <-b.done:
+		return waitErr(ctx, err)
+	case <-ctx.Done():
+	}
+
+	b.cancel()
+	if !abandon {
+		<-b.done
+	}
+	return ctx.Err()
+}
+
+// propagate calls cancel if ctx is done before stop is called.
+func propagate(ctx context.Context, cancel func()) (stop func()) {
+	stopped := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-stopped:
+		}
+	}()
+	return func() {
+		close(stopped)
+		<-finished
+	}
+}
+
+// waitErr returns ctx.Err() in place of errors caused by ctx being
+// done, unless the error already wraps ctx.Err().
+func waitErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		return ctx.Err()
+	}
+	return err
+}
+
+// copyContext copies src to dst until EOF or until ctx is done.
+//
+// The copy stops at the next read once ctx is done. A read which is
+// blocked at that point continues in the background until src is
+// closed or provides more data.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(dst, ctxReader{ctx, src})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return waitErr(ctx, err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ctxReader fails reads once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
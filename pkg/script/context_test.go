@@ -0,0 +1,160 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+// blocked is a task which runs until its context is done.
+func blocked() script.Task {
+	return script.Func(func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		<-ctx.Done()
+		return errors.New("stopped")
+	})
+}
+
+func TestWaitCancellation(t *testing.T) {
+	initial := runtime.NumGoroutine()
+	never := make(chan struct{})
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	tests := map[string]func() script.Task{
+		"func": blocked,
+		"func ignoring context": func() script.Task {
+			return script.Func(func(context.Context, io.Reader, io.Writer) error {
+				<-never
+				return nil
+			})
+		},
+		"file": func() script.Task {
+			return script.File(filepath.Join(t.TempDir(), "file")).Stdin(pr)
+		},
+		"sequence": func() script.Task {
+			return script.Sequence(blocked(), script.Echo("unexpected"))
+		},
+		"sequence replay": func() script.Task {
+			opts := script.SequenceOptions{ReplayStdin: true}
+			return script.SequenceWith(opts, blocked(), script.Echo("unexpected"))
+		},
+		"parallel": func() script.Task {
+			return script.Parallel(blocked(), blocked())
+		},
+		"parallel stdin": func() script.Task {
+			return script.Pipe(script.Echo("hello"), script.Parallel(blocked(), blocked()))
+		},
+		"parallel with": func() script.Task {
+			return script.ParallelWith(script.ParallelOptions{Limit: 1}, blocked(), blocked())
+		},
+		"pipe": func() script.Task {
+			return script.Pipe(blocked(), script.Cat(), script.Sort())
+		},
+		"if": func() script.Task {
+			return script.If(blocked(), script.Echo("unexpected"), script.Echo("unexpected"))
+		},
+		"or": func() script.Task {
+			return script.Or(blocked(), script.Echo("unexpected"))
+		},
+		"retry": func() script.Task {
+			return script.Retry(script.RetryPolicy{}, blocked())
+		},
+		"timeout": func() script.Task {
+			return script.Timeout(time.Hour, blocked())
+		},
+		"dir": func() script.Task {
+			return script.Dir(".", blocked())
+		},
+		"prefixed": func() script.Task {
+			return script.Prefixed("x", blocked())
+		},
+		"foreach": func() script.Task {
+			return script.ForEach(script.Items("a", "b"), func(string) script.Task {
+				return blocked()
+			}, script.ForEachOptions{})
+		},
+		"foreach lines": func() script.Task {
+			return script.ForEach(script.LinesOf(blocked()), func(item string) script.Task {
+				return script.Echo(item)
+			}, script.ForEachOptions{})
+		},
+		"graph": func() script.Task {
+			g := script.NewGraph(
+				script.Target{Name: "a", Task: blocked()},
+				script.Target{Name: "b", Deps: []string{"a"}, Task: script.Echo("unexpected")},
+			)
+			return g.Build("b")
+		},
+		"cached": func() script.Task {
+			cache := &script.Cache{Dir: t.TempDir()}
+			return cache.Cached(nil, nil, script.Describe("blocked", blocked()))
+		},
+	}
+
+	for name, task := range tests {
+		t.Run(name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			out, err := script.Output(ctx, task())
+			if !errors.Is(err, context.DeadlineExceeded) || out != "" {
+				t.Errorf("Unexpected %q %v", out, err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Error("Took too long", elapsed)
+			}
+			if name != "func ignoring context" && name != "file" {
+				checkGoroutines(t, before)
+			}
+		})
+	}
+
+	// the remaining goroutines complete once their input is done.
+	close(never)
+	pw.Close()
+	checkGoroutines(t, initial)
+}
+
+func TestCmdWaitCancellation(t *testing.T) {
+	before := runtime.NumGoroutine()
+	task := script.Pipe(script.Cmd("sleep", "30"), script.Cat())
+	if err := task.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// cancelling the context of Wait stops the command too.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := task.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Unexpected", err)
+	}
+	if elapsed := time.Since(start); elapsed > script.DefaultGracePeriod {
+		t.Error("Took too long", elapsed)
+	}
+	checkGoroutines(t, before)
+}
+
+// checkGoroutines checks that the number of goroutines drops to the
+// provided count.
+func checkGoroutines(t *testing.T, count int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > count {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Errorf("Leaked goroutines: %d > %d\n%s", runtime.NumGoroutine(), count, buf)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
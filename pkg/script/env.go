@@ -0,0 +1,209 @@
+package script
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Dir runs the task in the provided working directory.  Relative
+// directories are resolved against the directory of any enclosing
+// Dir task.
+//
+// This applies to all commands and files within the task tree
+// without changing the working directory of the current process,
+// so it is safe to use with Parallel.
+func Dir(dir string, t Task) Task {
+	update := func(e environ) environ {
+		e.dir = e.path(dir)
+		return e
+	}
+	shell := func(p *plan) string {
+		return "(cd " + shQuote(dir) + " && " + p.shell + ")"
+	}
+	return scoped{t, update, "cd " + dir, shell}
+}
+
+// Env runs the task with the provided environment variables (of the
+// form "key=value") added to or overriding the current environment.
+func Env(vars []string, t Task) Task {
+	update := func(e environ) environ {
+		e.env = append(e.environ(), vars...)
+		return e
+	}
+	quoted := make([]string, len(vars))
+	for kk, v := range vars {
+		quoted[kk] = shQuote(v)
+	}
+	shell := func(p *plan) string {
+		if p.level == shCommand {
+			return strings.Join(quoted, " ") + " " + p.shell
+		}
+		return "(export " + strings.Join(quoted, " ") + "; " + p.shell + ")"
+	}
+	return scoped{t, update, "env " + strings.Join(quoted, " "), shell}
+}
+
+// CleanEnv runs the task with an empty environment. It can be
+// combined with Env to provide an exact environment:
+//
+//     script.CleanEnv(script.Env([]string{"PATH=/bin"}, task))
+func CleanEnv(t Task) Task {
+	update := func(e environ) environ {
+		e.env = []string{}
+		return e
+	}
+	shell := func(p *plan) string {
+		return "env -i " + p.command()
+	}
+	return scoped{t, update, "env -i", shell}
+}
+
+// DefaultGracePeriod is the time commands are given to exit after
+// SIGTERM when their context is cancelled, before being killed.
+const DefaultGracePeriod = 5 * time.Second
+
+// GracePeriod sets the time commands within the task are given to
+// exit after SIGTERM when the context is cancelled.  Once it
+// elapses, the processes are killed via SIGKILL.  A zero period kills
+// them right away.
+func GracePeriod(d time.Duration, t Task) Task {
+	update := func(e environ) environ {
+		e.grace, e.hasGrace = d, true
+		return e
+	}
+	shell := func(p *plan) string {
+		return p.wrap(shCommand)
+	}
+	return scoped{t, update, "grace " + d.String(), shell}
+}
+
+// Getwd returns the working directory of the task running with the
+// provided context.  This is meant for use within Func tasks.
+func Getwd(ctx context.Context) (string, error) {
+	if e := environFrom(ctx); e.dir != "" {
+		return filepath.Abs(e.dir)
+	}
+	return os.Getwd()
+}
+
+// Environ returns the environment of the task running with the
+// provided context. This is meant for use within Func tasks.
+func Environ(ctx context.Context) []string {
+	return environFrom(ctx).environ()
+}
+
+// Getenv returns the value of the environment variable of the task
+// running with the provided context. This is meant for use within
+// Func tasks.
+func Getenv(ctx context.Context, key string) string {
+	env := Environ(ctx)
+	for kk := len(env) - 1; kk >= 0; kk-- {
+		if strings.HasPrefix(env[kk], key+"=") {
+			return env[kk][len(key)+1:]
+		}
+	}
+	return ""
+}
+
+// environ holds the working directory and environment of a task.
+type environ struct {
+	// dir is the working dir. Empty implies the current dir.
+	dir string
+
+	// env is the environment. Nil implies os.Environ().
+	env []string
+
+	// grace is the grace period for stopping commands. It is
+	// only valid if hasGrace is set.
+	grace    time.Duration
+	hasGrace bool
+}
+
+func (e environ) gracePeriod() time.Duration {
+	if !e.hasGrace {
+		return DefaultGracePeriod
+	}
+	return e.grace
+}
+
+func (e environ) environ() []string {
+	if e.env == nil {
+		return os.Environ()
+	}
+	return append([]string(nil), e.env...)
+}
+
+// path resolves a path relative to the working directory.
+func (e environ) path(path string) string {
+	if e.dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(e.dir, path)
+}
+
+type environKey struct{}
+
+func environFrom(ctx context.Context) environ {
+	e, _ := ctx.Value(environKey{}).(environ)
+	return e
+}
+
+// scoped runs a task with a modified environ.
+type scoped struct {
+	Task
+	update func(e environ) environ
+	label  string
+	shell  func(p *plan) string
+}
+
+func (s scoped) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, environKey{}, s.update(environFrom(ctx)))
+}
+
+func (s scoped) Start(ctx context.Context) error {
+	return s.Task.Start(s.context(ctx))
+}
+
+func (s scoped) Wait(ctx context.Context) error {
+	return s.Task.Wait(s.context(ctx))
+}
+
+func (s scoped) instance() Task {
+	s.Task = instance(s.Task)
+	return s
+}
+
+func (s scoped) unwrap() Task {
+	return s.Task
+}
+
+func (s scoped) Stdin(r io.Reader) Task {
+	s.Task = s.Task.Stdin(r)
+	return s
+}
+
+func (s scoped) Stdout(w io.Writer) Task {
+	s.Task = s.Task.Stdout(w)
+	return s
+}
+
+func (s scoped) Stderr(w io.Writer) Task {
+	s.Task = s.Task.Stderr(w)
+	return s
+}
+
+func (s scoped) plan(ctx context.Context, eval bool) (*plan, error) {
+	p, err := planOf(s.context(ctx), s.Task, eval)
+	if err != nil {
+		return nil, err
+	}
+	return &plan{label: s.label, shell: s.shell(p), children: []*plan{p}}, nil
+}
+
+func (s scoped) String() string {
+	return describe(s)
+}
@@ -0,0 +1,47 @@
+package script_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleDir() {
+	spec := script.Dir("/tmp", script.Parallel(
+		script.Cmd("pwd"),
+		script.Dir("..", script.Cmd("pwd")),
+	))
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Unordered output:
+	// /tmp
+	// /
+}
+
+func ExampleEnv() {
+	spec := script.Env([]string{"GREETING=hello"}, script.Sequence(
+		script.Cmd("sh", "-c", "echo $GREETING"),
+		script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+			_, err := fmt.Fprintln(w, script.Getenv(ctx, "GREETING"))
+			return err
+		}),
+		script.CleanEnv(script.Cmd("sh", "-c", "echo clean $GREETING")),
+	))
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	fmt.Println(os.Getenv("GREETING") == "")
+
+	// Output:
+	// hello
+	// hello
+	// clean
+	// true
+}
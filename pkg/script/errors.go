@@ -0,0 +1,186 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxStderrTail is the number of trailing bytes of stderr retained
+// by ExitError.
+const maxStderrTail = 4096
+
+// ExitError is returned when a command fails to run to completion
+// successfully.
+type ExitError struct {
+	// Args is the command line, including the program.
+	Args []string
+
+	// Dir is the working directory of the command. It is empty
+	// if the command ran in the current directory.
+	Dir string
+
+	// ExitCode is the exit code of the command or -1 if the
+	// command was terminated by a signal.
+	ExitCode int
+
+	// Signal is the signal which terminated the command, if any.
+	Signal os.Signal
+
+	// Duration is the time taken by the command.
+	Duration time.Duration
+
+	// Stderr holds the trailing output of stderr. It is only
+	// recorded if stderr is redirected to a writer which is
+	// neither a file nor the stdout of the command.
+	Stderr []byte
+
+	// Err is the underlying error, typically an *exec.ExitError.
+	// It is the context error if the command was stopped because
+	// its context was done.
+	Err error
+}
+
+func newExitError(c *exec.Cmd, duration time.Duration, stderr []byte, err error) *ExitError {
+	result := &ExitError{
+		Args:     c.Args,
+		Dir:      c.Dir,
+		ExitCode: -1,
+		Duration: duration,
+		Stderr:   stderr,
+		Err:      err,
+	}
+	if c.ProcessState != nil {
+		result.ExitCode = c.ProcessState.ExitCode()
+		type signaled interface {
+			Signaled() bool
+			Signal() syscall.Signal
+		}
+		if ws, ok := c.ProcessState.Sys().(signaled); ok && ws.Signaled() {
+			result.Signal = ws.Signal()
+		}
+	}
+	return result
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("%s: %v", strings.Join(e.Args, " "), e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// PipeError is returned by Pipe when any of its tasks fail.
+//
+// Like "set -o pipefail" in the shell, all the failures are
+// reported and not just the last one.
+type PipeError struct {
+	// Errors has the error for each task in the pipe, in order. It
+	// is nil for tasks which succeeded.
+	Errors []error
+}
+
+func (e *PipeError) Error() string {
+	msgs := []string{}
+	for kk, err := range e.Errors {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("pipe[%d]: %v", kk, err))
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the failed tasks matches the target.
+func (e *PipeError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if err != nil && errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first failed task which matches target.
+func (e *PipeError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if err != nil && errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors holds multiple errors such as the failures of tasks run
+// via ParallelWith.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for kk, err := range e {
+		msgs[kk] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Is reports whether any of the errors matches the target.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error which matches target.
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectErrors returns the non-nil errors as Errors or nil if there
+// are none.
+func collectErrors(errs []error) error {
+	var result Errors
+	for _, err := range errs {
+		if err != nil {
+			result = append(result, err)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// tailBuffer is an io.Writer which holds the last max bytes written.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) > t.max {
+		p = p[len(p)-t.max:]
+	}
+	if extra := len(t.buf) + len(p) - t.max; extra > 0 {
+		t.buf = append(t.buf[:0], t.buf[extra:]...)
+	}
+	t.buf = append(t.buf, p...)
+	return n, nil
+}
+
+func (t *tailBuffer) Bytes() []byte {
+	return append([]byte(nil), t.buf...)
+}
@@ -0,0 +1,102 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleExitError() {
+	spec := script.Sequence(
+		script.Cmd("true"),
+		script.Cmd("sh", "-c", "echo failed >&2; exit 3").Stderr(ioutil.Discard),
+		script.Cmd("true"),
+	)
+	err := script.Run(context.Background(), spec)
+
+	var exitErr *script.ExitError
+	if errors.As(err, &exitErr) {
+		fmt.Println(exitErr.Args, exitErr.ExitCode)
+		fmt.Printf("%q\n", exitErr.Stderr)
+	}
+
+	// Output:
+	// [sh -c echo failed >&2; exit 3] 3
+	// "failed\n"
+}
+
+func TestPipeError(t *testing.T) {
+	spec := script.Pipe(
+		script.Cmd("sh", "-c", "exit 2"),
+		script.Cmd("cat"),
+		script.Cmd("sh", "-c", "cat; exit 3"),
+	)
+	err := script.Run(context.Background(), spec)
+
+	var pipeErr *script.PipeError
+	if !errors.As(err, &pipeErr) || len(pipeErr.Errors) != 3 {
+		t.Fatal("unexpected error", err)
+	}
+
+	codes := []int{}
+	for _, err := range pipeErr.Errors {
+		var exitErr *script.ExitError
+		if errors.As(err, &exitErr) {
+			codes = append(codes, exitErr.ExitCode)
+		} else if err != nil {
+			t.Error("unexpected error", err)
+		}
+	}
+	if fmt.Sprint(codes) != "[2 3]" {
+		t.Error("unexpected exit codes", codes)
+	}
+
+	var exitErr *script.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 2 {
+		t.Error("unexpected first error", exitErr)
+	}
+}
+
+func TestExitErrorSignal(t *testing.T) {
+	err := script.Run(context.Background(), script.Cmd("sh", "-c", "kill -9 $$"))
+
+	var exitErr *script.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Signal == nil || exitErr.ExitCode != -1 {
+		t.Fatal("unexpected error", err)
+	}
+	if exitErr.Signal.String() != "killed" {
+		t.Error("unexpected signal", exitErr.Signal)
+	}
+}
+
+func TestMergeStderrOrder(t *testing.T) {
+	// stdout and stderr share a pipe as with 2>&1, so the output
+	// is interleaved in the order it was written.
+	loop := "for i in 1 2 3 4 5 6 7 8 9 10; do echo out$i; echo err$i >&2; done"
+	out, err := script.Output(context.Background(), script.MergeStderr(script.Cmd("sh", "-c", loop)))
+
+	expected := ""
+	for kk := 1; kk <= 10; kk++ {
+		expected += fmt.Sprintf("out%d\nerr%d\n", kk, kk)
+	}
+	if err != nil || out != expected {
+		t.Errorf("unexpected output %q %v", out, err)
+	}
+}
+
+func TestCmdBackgroundDescendant(t *testing.T) {
+	// the background sleep inherits stderr, which must not keep
+	// the command waiting.
+	start := time.Now()
+	if err := script.Run(context.Background(), script.Cmd("sh", "-c", "sleep 2 &")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("Waited for background process", elapsed)
+	}
+}
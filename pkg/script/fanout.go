@@ -0,0 +1,217 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+)
+
+// fanout copies a reader to multiple readers, buffering as needed
+// so that a slow reader does not hold back the others.
+//
+// Copying stops once ctx is done or all the readers are done.  Note
+// that a read of the source which is blocked at that point is
+// abandoned.
+type fanout struct {
+	pipes []*bufferedPipe
+}
+
+// fanoutBuffer is the input buffered per reader before copying waits
+// for the reader to catch up.
+const fanoutBuffer = 1 << 20
+
+// newFanout starts copying r into n readers.  A nil reader is
+// treated as empty.  Each reader buffers at most limit bytes, with
+// zero meaning no limit.
+func newFanout(ctx context.Context, r io.Reader, n, limit int) *fanout {
+	f := &fanout{make([]*bufferedPipe, n)}
+	for kk := range f.pipes {
+		f.pipes[kk] = newBufferedPipe(limit)
+	}
+	if r == nil {
+		r = strings.NewReader("")
+	}
+	go f.copy(ctx, r)
+	return f
+}
+
+func (f *fanout) copy(ctx context.Context, r io.Reader) {
+	stop := propagate(ctx, func() { f.closeWrite(ctx.Err()) })
+	defer stop()
+
+	buf := make([]byte, 32*1024) //nolint: gomnd
+	for {
+		n, err := ctxReader{ctx, r}.Read(buf)
+		if n > 0 {
+			open := false
+			for _, p := range f.pipes {
+				if p.write(buf[:n]) {
+					open = true
+				}
+			}
+			if !open {
+				err = io.EOF
+			}
+		}
+		if err != nil {
+			f.closeWrite(err)
+			return
+		}
+	}
+}
+
+func (f *fanout) closeWrite(err error) {
+	for _, p := range f.pipes {
+		p.closeWrite(err)
+	}
+}
+
+// reader returns the nth reader.
+func (f *fanout) reader(n int) io.Reader {
+	return f.pipes[n]
+}
+
+// done discards any further input for the nth reader.
+func (f *fanout) done(n int) {
+	f.pipes[n].closeRead()
+}
+
+// bufferedPipe is an in-memory pipe with an optionally bounded
+// buffer.
+type bufferedPipe struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	limit  int
+	err    error
+	closed bool
+}
+
+func newBufferedPipe(limit int) *bufferedPipe {
+	p := &bufferedPipe{limit: limit}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// write waits for room in the buffer and then adds the data to it.
+// It returns false if the data is discarded as the pipe is closed.
+func (p *bufferedPipe) write(data []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.limit > 0 && p.buf.Len() >= p.limit && !p.closed && p.err == nil {
+		p.cond.Wait()
+	}
+	if p.closed || p.err != nil {
+		return false
+	}
+	p.buf.Write(data)
+	p.cond.Broadcast()
+	return true
+}
+
+// closeWrite ends the input of the reader with err, which is io.EOF
+// if the input is complete.  Only the first error is kept.
+func (p *bufferedPipe) closeWrite(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.cond.Broadcast()
+}
+
+func (p *bufferedPipe) closeRead() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.buf = bytes.Buffer{}
+	p.cond.Broadcast()
+}
+
+func (p *bufferedPipe) Read(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.buf.Len() == 0 && p.err == nil {
+		p.cond.Wait()
+	}
+	if p.buf.Len() > 0 {
+		p.cond.Broadcast()
+		return p.buf.Read(data)
+	}
+	return 0, p.err
+}
+
+// broadcast runs tasks in parallel with each task receiving all of
+// the input.
+type broadcast struct {
+	tasks   parallel
+	stdin   io.Reader
+	fan     *fanout
+	running parallel
+}
+
+func (b *broadcast) Start(ctx context.Context) error {
+	b.fan = newFanout(ctx, b.stdin, len(b.tasks), fanoutBuffer)
+	b.running = make(parallel, len(b.tasks))
+	for kk := range b.tasks {
+		b.running[kk] = b.tasks[kk].Stdin(b.fan.reader(kk))
+	}
+	if err := b.running.Start(ctx); err != nil {
+		for kk := range b.running {
+			b.fan.done(kk)
+		}
+		return err
+	}
+	return nil
+}
+
+// Wait waits for the tasks concurrently so that the input of a task
+// which is done is discarded right away rather than holding back
+// the others.
+func (b *broadcast) Wait(ctx context.Context) error {
+	if b.fan == nil {
+		return nil
+	}
+	errs := make(chan error, len(b.running))
+	for kk, t := range b.running {
+		go func(kk int, t Task) {
+			err := t.Wait(ctx)
+			b.fan.done(kk)
+			errs <- err
+		}(kk, t)
+	}
+
+	var err error
+	for range b.running {
+		if err2 := <-errs; err2 != nil {
+			err = err2
+		}
+	}
+	return waitErr(ctx, err)
+}
+
+func (b *broadcast) instance() Task {
+	return &broadcast{tasks: instances(b.tasks), stdin: b.stdin}
+}
+
+func (b *broadcast) Stdin(r io.Reader) Task {
+	return &broadcast{tasks: b.tasks, stdin: r}
+}
+
+func (b *broadcast) Stdout(w io.Writer) Task {
+	return &broadcast{tasks: b.tasks.Stdout(w).(parallel), stdin: b.stdin}
+}
+
+func (b *broadcast) Stderr(w io.Writer) Task {
+	return &broadcast{tasks: b.tasks.Stderr(w).(parallel), stdin: b.stdin}
+}
+
+func (b *broadcast) plan(ctx context.Context, eval bool) (*plan, error) {
+	return b.tasks.plan(ctx, eval)
+}
+
+func (b *broadcast) String() string {
+	return describe(b)
+}
@@ -0,0 +1,130 @@
+package script_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleParallel_stdin() {
+	spec := script.Pipe(
+		script.Cmd("printf", "hello\nworld\n"),
+		script.Parallel(
+			script.Cmd("sed", "s/^/one: /"),
+			script.Cmd("true"),
+			script.Cmd("sed", "s/^/two: /"),
+		),
+	)
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Unordered output:
+	// one: hello
+	// one: world
+	// two: hello
+	// two: world
+}
+
+func ExampleParallelWith_stdin() {
+	input := strings.Repeat("x", 1<<20) + "\n"
+	spec := script.ParallelWith(
+		script.ParallelOptions{Limit: 1},
+		script.Cmd("true"),
+		script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+			n, err := io.Copy(ioutil.Discard, r)
+			fmt.Fprintln(w, n)
+			return err
+		}),
+	).Stdin(strings.NewReader(input))
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output: 1048577
+}
+
+func ExampleSequenceWith() {
+	spec := script.SequenceWith(
+		script.SequenceOptions{ReplayStdin: true},
+		script.Cmd("head", "-n", "1"),
+		script.Cmd("tail", "-n", "1"),
+	).Stdin(strings.NewReader("hello\nworld\n"))
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// hello
+	// world
+}
+
+func TestParallelNilStdin(t *testing.T) {
+	spec := script.Parallel(script.Cmd("true"), script.Cat()).Stdin(nil)
+	if out, err := script.Output(context.Background(), spec); out != "" || err != nil {
+		t.Errorf("Unexpected %q %v", out, err)
+	}
+}
+
+// endless provides an endless stream of lines, counting the reads.
+type endless struct {
+	reads int64
+}
+
+func (e *endless) Read(p []byte) (int, error) {
+	atomic.AddInt64(&e.reads, 1)
+	return copy(p, bytes.Repeat([]byte("y\n"), len(p)/2)), nil
+}
+
+func TestParallelEndlessStdin(t *testing.T) {
+	tasks := map[string]script.Task{
+		"plain": script.Parallel(script.Head(1), script.Cmd("head", "-n", "1")),
+		"with":  script.ParallelWith(script.ParallelOptions{Limit: 2}, script.Head(1), script.Head(1)),
+	}
+	for name, task := range tasks {
+		r := &endless{}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		out, err := script.Output(ctx, task.Stdin(r))
+		cancel()
+		if out != "y\ny\n" || err != nil {
+			t.Errorf("%s: Unexpected %q %v", name, out, err)
+		}
+
+		// copying stops once all the tasks are done.
+		time.Sleep(10 * time.Millisecond)
+		reads := atomic.LoadInt64(&r.reads)
+		time.Sleep(50 * time.Millisecond)
+		if n := atomic.LoadInt64(&r.reads); n != reads {
+			t.Errorf("%s: still reading stdin %d %d", name, reads, n)
+		}
+	}
+
+	// or once the context is done.
+	r := &endless{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	blocked := script.Func(func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := script.Run(ctx, script.Parallel(blocked, script.Cmd("true")).Stdin(r)); err == nil {
+		t.Error("unexpected success")
+	}
+	time.Sleep(10 * time.Millisecond)
+	reads := atomic.LoadInt64(&r.reads)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&r.reads); n != reads {
+		t.Errorf("still reading stdin %d %d", reads, n)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 type file struct {
 	path   string
+	append bool
 	stdin  io.Reader
 	stdout io.Writer
 	f      *os.File
@@ -15,10 +16,13 @@ type file struct {
 
 func (f *file) Start(ctx context.Context) error {
 	var err error
-	if f.stdin != nil {
-		f.f, err = os.Create(f.path)
+	path := environFrom(ctx).path(f.path)
+	if f.stdin != nil && f.append {
+		f.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666) //nolint: gomnd
+	} else if f.stdin != nil {
+		f.f, err = os.Create(path)
 	} else if f.stdout != nil {
-		f.f, err = os.Open(f.path)
+		f.f, err = os.Open(path)
 	}
 	return err
 }
@@ -29,13 +33,14 @@ func (f *file) Wait(ctx context.Context) error {
 	}
 	defer f.f.Close()
 
-	var err error
 	if f.stdin != nil {
-		_, err = io.Copy(f.f, f.stdin)
-	} else {
-		_, err = io.Copy(f.stdout, f.f)
+		return copyContext(ctx, f.f, f.stdin)
 	}
-	return err
+	return copyContext(ctx, f.stdout, f.f)
+}
+
+func (f *file) instance() Task {
+	return &file{path: f.path, append: f.append, stdin: f.stdin, stdout: f.stdout}
 }
 
 func (f *file) Stdin(r io.Reader) Task {
@@ -49,3 +54,101 @@ func (f *file) Stdout(w io.Writer) Task {
 	result.stdout = w
 	return &result
 }
+
+// Stderr is a no-op as files do not produce diagnostic output.
+func (f *file) Stderr(w io.Writer) Task {
+	return f
+}
+
+func (f *file) plan(ctx context.Context, eval bool) (*plan, error) {
+	return f.redirect(f.stdin != nil || f.append), nil
+}
+
+// redirect describes the file as the shell redirection for reading
+// from it or, if sink is set, writing to it.
+func (f *file) redirect(sink bool) *plan {
+	s := "< " + shQuote(f.path)
+	switch {
+	case sink && f.append:
+		s = ">> " + shQuote(f.path)
+	case sink:
+		s = "> " + shQuote(f.path)
+	}
+	return &plan{label: s, shell: s}
+}
+
+func (f *file) String() string {
+	return describe(f)
+}
+
+// stderrFile writes the stderr of a task to a file.
+type stderrFile struct {
+	Task
+	path    string
+	append  bool
+	running Task
+	f       *os.File
+}
+
+func (s *stderrFile) Start(ctx context.Context) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if s.append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(environFrom(ctx).path(s.path), flags, 0666) //nolint: gomnd
+	if err != nil {
+		return err
+	}
+	s.f, s.running = f, s.Task.Stderr(f)
+	if err := s.running.Start(ctx); err != nil {
+		s.f.Close()
+		s.running = nil
+		return err
+	}
+	return nil
+}
+
+func (s *stderrFile) Wait(ctx context.Context) error {
+	if s.running == nil {
+		return nil
+	}
+	defer s.f.Close()
+	return s.running.Wait(ctx)
+}
+
+func (s *stderrFile) instance() Task {
+	return &stderrFile{Task: instance(s.Task), path: s.path, append: s.append}
+}
+
+func (s *stderrFile) unwrap() Task {
+	return s.Task
+}
+
+func (s *stderrFile) Stdin(r io.Reader) Task {
+	return &stderrFile{Task: s.Task.Stdin(r), path: s.path, append: s.append}
+}
+
+func (s *stderrFile) Stdout(w io.Writer) Task {
+	return &stderrFile{Task: s.Task.Stdout(w), path: s.path, append: s.append}
+}
+
+// Stderr is a no-op as stderr goes to the file.
+func (s *stderrFile) Stderr(w io.Writer) Task {
+	return s
+}
+
+func (s *stderrFile) plan(ctx context.Context, eval bool) (*plan, error) {
+	p, err := planOf(ctx, s.Task, eval)
+	if err != nil {
+		return nil, err
+	}
+	op := " 2> "
+	if s.append {
+		op = " 2>> "
+	}
+	return &plan{label: op[1:] + shQuote(s.path), shell: p.wrap(shCommand) + op + shQuote(s.path), children: []*plan{p}}, nil
+}
+
+func (s *stderrFile) String() string {
+	return describe(s)
+}
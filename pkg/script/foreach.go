@@ -0,0 +1,475 @@
+package script
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// Source provides the items for ForEach. NextPath returns io.EOF
+// when there are no more items.
+//
+// This matches watch.Stream, so file watchers can be used as sources
+// directly.  Sources which implement io.Closer are closed when
+// ForEach is done with them.
+type Source interface {
+	NextPath(ctx context.Context) (string, error)
+}
+
+// Items is a source with a fixed list of items.
+func Items(items ...string) Source {
+	return &itemsSource{items: items}
+}
+
+// LinesOf is a source with the lines of the output of a task, such
+// as "go list ./...". Empty lines are skipped.
+//
+// The task runs concurrently with ForEach, so items are processed as
+// soon as they are output.  The source fails if the task fails.
+func LinesOf(t Task) Source {
+	return &linesSource{task: t}
+}
+
+// Glob is a source with the paths matching the pattern, which can
+// use "**" to match any number of directories.  Relative patterns are
+// resolved against the directory set via Dir and the paths are
+// relative to it as well.
+func Glob(pattern string) Source {
+	return &globSource{pattern: pattern}
+}
+
+// ForEachOptions configures ForEach and ForEachBatch.
+type ForEachOptions struct {
+	// Limit is the maximum number of tasks run at the same
+	// time. Zero or one means the tasks are run in sequence.
+	Limit int
+
+	// Batch is the maximum number of items passed to each call
+	// of the ForEachBatch function.  Zero means one.  This is
+	// not used by ForEach.
+	Batch int
+
+	// KeepGoing runs the tasks for all items even if some of
+	// them fail. By default, no new tasks are started once a task
+	// fails though the running tasks are allowed to complete.
+	KeepGoing bool
+}
+
+// ForEach runs the task returned by fn for each item of the source,
+// like "xargs -n 1".
+//
+// If source is nil, the items are the lines of the input provided
+// via Stdin.  The output of each task goes to the output of ForEach.
+//
+// If any task fails, the returned error is Errors holding all the
+// failures in the order of the items.
+//
+// DryRun describes the task returned by fn for the placeholder item
+// "$@", similar to "xargs sh -c".
+func ForEach(source Source, fn func(item string) Task, opts ForEachOptions) Task {
+	opts.Batch = 1
+	return ForEachBatch(source, func(items []string) Task {
+		return fn(items[0])
+	}, opts)
+}
+
+// ForEachBatch is like ForEach but calls fn with up to opts.Batch
+// items at a time, like "xargs -n".
+func ForEachBatch(source Source, fn func(items []string) Task, opts ForEachOptions) Task {
+	return &forEach{source: source, fn: fn, opts: opts}
+}
+
+type forEach struct {
+	source Source
+	fn     func(items []string) Task
+	opts   ForEachOptions
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	bg     *background
+}
+
+func (f *forEach) Start(ctx context.Context) error {
+	f.bg = runBackground(ctx, f.run)
+	return nil
+}
+
+func (f *forEach) run(ctx context.Context) error {
+	source := f.source
+	if source == nil {
+		source = newLineReader(f.stdin)
+	} else if o, ok := source.(opener); ok {
+		source = o.open()
+	}
+	if closer, ok := source.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// sourceCtx is cancelled when a task fails to stop reading
+	// from sources which may block indefinitely.
+	sourceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limit, batch := f.opts.Limit, f.opts.Batch
+	if limit < 1 {
+		limit = 1
+	}
+	if batch < 1 {
+		batch = 1
+	}
+	sem := make(chan struct{}, limit)
+
+	// errs has an entry per batch, followed by any source error.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	failed := false
+	slot := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, nil)
+		return len(errs) - 1
+	}
+	fail := func(index int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs[index] = err
+		if !f.opts.KeepGoing {
+			failed = true
+			cancel()
+		}
+	}
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return failed
+	}
+
+loop:
+	for !stopped() {
+		items, err := nextBatch(sourceCtx, source, batch)
+		if len(items) > 0 {
+			index := slot()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				fail(index, ctx.Err())
+				break loop
+			}
+			if stopped() {
+				<-sem
+				break
+			}
+
+			wg.Add(1)
+			go func(t Task) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := Run(ctx, t); err != nil {
+					fail(index, err)
+				}
+			}(f.task(items))
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !stopped() {
+				fail(slot(), err)
+			}
+			break
+		}
+	}
+	wg.Wait()
+
+	return collectErrors(errs)
+}
+
+// nextBatch reads up to n items from the source.
+func nextBatch(ctx context.Context, source Source, n int) ([]string, error) {
+	var items []string
+	for len(items) < n {
+		item, err := source.NextPath(ctx)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// task creates the task for the items.
+func (f *forEach) task(items []string) Task {
+	t := f.fn(items)
+	if f.stdout != nil {
+		t = t.Stdout(f.stdout)
+	}
+	if f.stderr != nil {
+		t = t.Stderr(f.stderr)
+	}
+	return t
+}
+
+func (f *forEach) Wait(ctx context.Context) error {
+	if f.bg == nil {
+		return nil
+	}
+	return f.bg.wait(ctx, false)
+}
+
+func (f forEach) instance() Task {
+	f.bg = nil
+	return &f
+}
+
+// Stdin provides the items when the source is nil. It is ignored
+// otherwise.
+func (f forEach) Stdin(r io.Reader) Task {
+	f.stdin = r
+	f.bg = nil
+	return &f
+}
+
+func (f forEach) Stdout(w io.Writer) Task {
+	f.stdout = w
+	f.bg = nil
+	return &f
+}
+
+func (f forEach) Stderr(w io.Writer) Task {
+	f.stderr = w
+	f.bg = nil
+	return &f
+}
+
+func (f *forEach) plan(ctx context.Context, eval bool) (*plan, error) {
+	// the items are passed to "sh -c" as "$@".
+	child, err := planOf(ctx, f.fn([]string{"$@"}), false)
+	if err != nil {
+		return nil, err
+	}
+	inner := strings.ReplaceAll(child.shell, shQuote("$@"), `"$@"`)
+
+	args := []string{"xargs"}
+	if f.opts.Batch > 1 {
+		args = append(args, "-n", fmt.Sprint(f.opts.Batch))
+	} else {
+		args = append(args, "-n", "1")
+	}
+	if f.opts.Limit > 1 {
+		args = append(args, "-P", fmt.Sprint(f.opts.Limit))
+	}
+	shell := strings.Join(args, " ") + " sh -c " + shQuote(inner) + " _"
+	label := "foreach"
+	if f.source != nil {
+		src := sourceShell(f.source)
+		shell = src + " | " + shell
+		label += " " + src
+	}
+	return &plan{label: label, shell: shell, level: shPipeline, children: []*plan{child}}, nil
+}
+
+func (f *forEach) String() string {
+	return describe(f)
+}
+
+// opener is implemented by sources which can be reused: each use
+// opens a new source.
+type opener interface {
+	open() Source
+}
+
+// sourceShell describes a source as a shell command writing the
+// items.
+func sourceShell(s Source) string {
+	if stringer, ok := s.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+type itemsSource struct {
+	items []string
+}
+
+func (s *itemsSource) open() Source {
+	return &itemsSource{s.items}
+}
+
+func (s *itemsSource) NextPath(ctx context.Context) (string, error) {
+	if len(s.items) == 0 {
+		return "", io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
+
+func (s *itemsSource) String() string {
+	quoted := []string{"printf", shQuote(`%s\n`)}
+	for _, item := range s.items {
+		quoted = append(quoted, shQuote(item))
+	}
+	return strings.Join(quoted, " ")
+}
+
+type globSource struct {
+	pattern string
+	items   Source
+}
+
+func (s *globSource) open() Source {
+	return &globSource{pattern: s.pattern}
+}
+
+func (s *globSource) NextPath(ctx context.Context) (string, error) {
+	if s.items == nil {
+		env := environFrom(ctx)
+		matches, err := doublestar.Glob(env.path(s.pattern))
+		if err != nil {
+			return "", err
+		}
+		if env.dir != "" && !filepath.IsAbs(s.pattern) {
+			for kk, match := range matches {
+				if matches[kk], err = filepath.Rel(env.dir, match); err != nil {
+					return "", err
+				}
+			}
+		}
+		sort.Strings(matches)
+		s.items = Items(matches...)
+	}
+	return s.items.NextPath(ctx)
+}
+
+func (s *globSource) String() string {
+	return "printf " + shQuote(`%s\n`) + " " + s.pattern
+}
+
+type linesSource struct {
+	task   Task
+	lines  *lineReader
+	r      *io.PipeReader
+	cancel func()
+	done   chan error
+}
+
+func (s *linesSource) open() Source {
+	return &linesSource{task: s.task}
+}
+
+func (s *linesSource) NextPath(ctx context.Context) (string, error) {
+	if s.lines == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		r, w := io.Pipe()
+		s.lines, s.r, s.cancel, s.done = newLineReader(r), r, cancel, make(chan error, 1)
+		go func() {
+			err := Run(ctx, s.task.Stdout(w))
+			w.Close()
+			s.done <- err
+		}()
+	}
+
+	line, err := s.lines.NextPath(ctx)
+	if err == io.EOF {
+		if err = <-s.done; err == nil {
+			err = io.EOF
+		}
+		s.done <- err
+	}
+	return line, err
+}
+
+// Close stops the task if it is still running.
+func (s *linesSource) Close() error {
+	if s.lines == nil {
+		return nil
+	}
+	s.cancel()
+	s.r.Close()
+	<-s.done
+	return nil
+}
+
+func (s *linesSource) String() string {
+	p, err := planOf(context.Background(), s.task, false)
+	if err != nil {
+		return err.Error()
+	}
+	return p.wrap(shPipeline)
+}
+
+// lineReader is a source with the non-empty lines of a reader.
+//
+// Reads which may block are done in the background so that NextPath
+// returns once ctx is done.  A read abandoned this way is picked up
+// by the next call.
+type lineReader struct {
+	r       *bufio.Reader
+	pending chan lineResult
+}
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	if r == nil {
+		r = strings.NewReader("")
+	}
+	return &lineReader{r: bufio.NewReader(r)}
+}
+
+func (l *lineReader) NextPath(ctx context.Context) (string, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		res, err := l.read(ctx)
+		if err != nil {
+			return "", err
+		}
+		line := strings.TrimSuffix(strings.TrimSuffix(res.line, "\n"), "\r")
+		if line != "" {
+			return line, nil
+		}
+		if res.err != nil {
+			return "", res.err
+		}
+	}
+}
+
+// read reads the next line, failing with ctx.Err() if ctx is done
+// first.
+func (l *lineReader) read(ctx context.Context) (lineResult, error) {
+	if l.pending == nil {
+		buffered, _ := l.r.Peek(l.r.Buffered())
+		if bytes.IndexByte(buffered, '\n') != -1 || ctx.Done() == nil {
+			line, err := l.r.ReadString('\n')
+			return lineResult{line, err}, nil
+		}
+		l.pending = make(chan lineResult, 1)
+		go func(pending chan lineResult) {
+			line, err := l.r.ReadString('\n')
+			pending <- lineResult{line, err}
+		}(l.pending)
+	}
+
+	select {
+	case res := <-l.pending:
+		l.pending = nil
+		return res, nil
+	case <-ctx.Done():
+		return lineResult{}, ctx.Err()
+	}
+}
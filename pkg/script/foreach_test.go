@@ -0,0 +1,301 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+	"github.com/tvastar/gotools/pkg/watch"
+)
+
+func ExampleForEach() {
+	task := script.Pipe(
+		script.Echo("a\nb\n\nc"),
+		script.ForEach(nil, func(item string) script.Task {
+			return script.Echo("item", item)
+		}, script.ForEachOptions{}),
+	)
+	if err := script.Run(context.Background(), task); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// item a
+	// item b
+	// item c
+}
+
+func ExampleForEachBatch() {
+	task := script.ForEachBatch(script.Items("a", "b", "c", "d", "e"), func(items []string) script.Task {
+		return script.Echo(items...)
+	}, script.ForEachOptions{Batch: 2})
+	if err := script.Run(context.Background(), task); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// a b
+	// c d
+	// e
+}
+
+func ExampleForEach_dryRun() {
+	task := script.ForEach(script.LinesOf(script.Cmd("go", "list", "./...")), func(pkg string) script.Task {
+		return script.Cmd("go", "vet", pkg)
+	}, script.ForEachOptions{Limit: 4})
+	if err := script.DryRunShell(context.Background(), os.Stdout, task); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output: go list ./... | xargs -n 1 -P 4 sh -c 'go vet "$@"' _
+}
+
+// recorder records the items processed along with the maximum
+// concurrency.
+type recorder struct {
+	sync.Mutex
+	items            []string
+	running, maxSeen int
+}
+
+func (r *recorder) task(item string) script.Task {
+	return script.Func(func(ctx context.Context, _ io.Reader, w io.Writer) error {
+		r.Lock()
+		r.items = append(r.items, item)
+		r.running++
+		if r.running > r.maxSeen {
+			r.maxSeen = r.running
+		}
+		r.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		r.Lock()
+		r.running--
+		r.Unlock()
+		if strings.HasPrefix(item, "fail") {
+			return errors.New(item)
+		}
+		return nil
+	})
+}
+
+func TestForEachLimit(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, limit := range []int{0, 1, 3} {
+		var r recorder
+		task := script.ForEach(script.Items(items...), r.task, script.ForEachOptions{Limit: limit})
+
+		// run twice to ensure sources can be reused.
+		for kk := 0; kk < 2; kk++ {
+			if err := script.Run(context.Background(), task); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected := 1
+		if limit > 1 {
+			expected = limit
+		}
+		if r.maxSeen > expected || len(r.items) != 2*len(items) {
+			t.Error("Unexpected", limit, r.maxSeen, r.items)
+		}
+	}
+}
+
+func TestForEachErrors(t *testing.T) {
+	items := script.Items("a", "fail1", "b", "fail2", "c")
+
+	var r recorder
+	err := script.Run(context.Background(), script.ForEach(items, r.task, script.ForEachOptions{}))
+	if err == nil || err.Error() != "fail1" || !reflect.DeepEqual(r.items, []string{"a", "fail1"}) {
+		t.Error("Unexpected", err, r.items)
+	}
+
+	r = recorder{}
+	opts := script.ForEachOptions{Limit: 2, KeepGoing: true}
+	err = script.Run(context.Background(), script.ForEach(items, r.task, opts))
+	var errs script.Errors
+	if !errors.As(err, &errs) || len(errs) != 2 || errs[0].Error() != "fail1" || errs[1].Error() != "fail2" {
+		t.Error("Unexpected", err)
+	}
+	sort.Strings(r.items)
+	if !reflect.DeepEqual(r.items, []string{"a", "b", "c", "fail1", "fail2"}) {
+		t.Error("Unexpected", r.items)
+	}
+}
+
+func TestForEachGlob(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	setup := script.Dir(dir, script.Sequence(
+		script.Mkdir("a/b"),
+		script.Touch("x.go", "a/y.go", "a/b/z.go", "a/b/z.txt"),
+	))
+	if err := script.Run(ctx, setup); err != nil {
+		t.Fatal(err)
+	}
+
+	task := script.Dir(dir, script.ForEach(script.Glob("**/*.go"), func(path string) script.Task {
+		return script.Cat(path, "-").Stdin(strings.NewReader(path + "\n"))
+	}, script.ForEachOptions{}))
+	lines, err := script.Lines(ctx, task)
+	if err != nil || !reflect.DeepEqual(lines, []string{"a/b/z.go", "a/y.go", "x.go"}) {
+		t.Error("Unexpected", lines, err)
+	}
+}
+
+func TestForEachLinesOf(t *testing.T) {
+	ctx := context.Background()
+	source := script.LinesOf(script.Sequence(script.Echo("a\nb"), script.Error(errors.New("source failed"))))
+	var r recorder
+	err := script.Run(ctx, script.ForEach(source, r.task, script.ForEachOptions{}))
+	if err == nil || err.Error() != "source failed" || !reflect.DeepEqual(r.items, []string{"a", "b"}) {
+		t.Error("Unexpected", err, r.items)
+	}
+
+	// an endless producer is stopped when a task fails.
+	endless := script.Func(func(ctx context.Context, _ io.Reader, w io.Writer) error {
+		for kk := 0; ; kk++ {
+			if _, err := fmt.Fprintf(w, "fail%d\n", kk); err != nil {
+				return err
+			}
+		}
+	})
+	r = recorder{}
+	err = script.Run(ctx, script.ForEach(script.LinesOf(endless), r.task, script.ForEachOptions{}))
+	if err == nil || err.Error() != "fail0" || len(r.items) != 1 {
+		t.Error("Unexpected", err, r.items)
+	}
+}
+
+// blockingSource provides its items and then blocks until the
+// context is done, like a file watcher.
+type blockingSource struct {
+	items  []string
+	closed bool
+}
+
+func (b *blockingSource) NextPath(ctx context.Context) (string, error) {
+	if len(b.items) == 0 {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	item := b.items[0]
+	b.items = b.items[1:]
+	return item, nil
+}
+
+func (b *blockingSource) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestForEachStream(t *testing.T) {
+	var r recorder
+	source := &blockingSource{items: []string{"a", "fail"}}
+	err := script.Run(context.Background(), script.ForEach(source, r.task, script.ForEachOptions{}))
+	if err == nil || err.Error() != "fail" || !source.closed {
+		t.Error("Unexpected", err, source.closed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	source = &blockingSource{items: []string{"a", "b"}}
+	err = script.Run(ctx, script.ForEach(source, r.task, script.ForEachOptions{KeepGoing: true}))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Unexpected", err)
+	}
+}
+
+func TestForEachStdinCanceled(t *testing.T) {
+	var r recorder
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- script.Run(ctx, script.ForEach(nil, r.task, script.ForEachOptions{}).Stdin(pr))
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("Unexpected", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ForEach did not stop reading stdin")
+	}
+}
+
+// closeRecorder records whether the stream is closed.
+type closeRecorder struct {
+	watch.Stream
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return watch.Close(c.Stream)
+}
+
+func TestForEachWatchStream(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"b.txt":     {Data: []byte("b")},
+		"sub/c.txt": {Data: []byte("c")},
+	}
+
+	// a snapshot ends after all the files and directories.
+	var r recorder
+	source := &closeRecorder{Stream: watch.FSSnap(fsys, ".")}
+	if err := script.Run(context.Background(), script.ForEach(source, r.task, script.ForEachOptions{})); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(r.items)
+	if !reflect.DeepEqual(r.items, []string{".", "a.txt", "b.txt", "sub", "sub/c.txt"}) || !source.closed {
+		t.Error("Unexpected", r.items, source.closed)
+	}
+
+	// a watcher never ends, so a failure stops it.
+	fail := func(item string) script.Task {
+		if item == "b.txt" {
+			return script.Error(errors.New("fail"))
+		}
+		return script.Echo(item).Stdout(io.Discard)
+	}
+	source = &closeRecorder{Stream: watch.FS(fsys, ".")}
+	done := make(chan error, 1)
+	go func() {
+		done <- script.Run(context.Background(), script.ForEach(source, fail, script.ForEachOptions{}))
+	}()
+	select {
+	case err := <-done:
+		if err == nil || err.Error() != "fail" || !source.closed {
+			t.Error("Unexpected", err, source.closed)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ForEach did not stop the watcher")
+	}
+
+	// with KeepGoing, only cancellation stops it.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	source = &closeRecorder{Stream: watch.FS(fsys, ".")}
+	err := script.Run(ctx, script.ForEach(source, fail, script.ForEachOptions{KeepGoing: true}))
+	if !errors.Is(err, context.DeadlineExceeded) || !source.closed {
+		t.Error("Unexpected", err, source.closed)
+	}
+}
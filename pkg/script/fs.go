@@ -0,0 +1,327 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// Mkdir creates the directories along with any missing parents, like
+// "mkdir -p".
+//
+// Relative paths used by the filesystem tasks are resolved against
+// the directory set via Dir.
+func Mkdir(paths ...string) Task {
+	return builtin("mkdir -p", paths, func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		env := environFrom(ctx)
+		for _, path := range paths {
+			if err := os.MkdirAll(env.path(path), 0777); err != nil { //nolint: gomnd
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CopyOptions controls which files are copied by CopyWith.
+//
+// The patterns are matched against the slash-separated path relative
+// to the source directory and can use "**" to match any number of
+// directories.
+type CopyOptions struct {
+	// Include limits the copy to the files matching any of the
+	// patterns.  All files are copied if it is empty.
+	Include []string
+
+	// Exclude skips files and directories matching any of the
+	// patterns.
+	Exclude []string
+}
+
+// Copy copies a file or a directory tree, like "cp -R src/. dst".
+// File modes and symbolic links are preserved and existing files are
+// overwritten.  A file copied to an existing directory is placed in
+// it.
+func Copy(src, dst string) Task {
+	return CopyWith(CopyOptions{}, src, dst)
+}
+
+// CopyWith is like Copy but only copies the files selected by the
+// options, like "rsync -a" with include and exclude filters.
+func CopyWith(opts CopyOptions, src, dst string) Task {
+	name, args := "cp -R", []string{src + "/.", dst}
+	if len(opts.Include)+len(opts.Exclude) > 0 {
+		name, args = "rsync -a", nil
+		for _, pattern := range opts.Exclude {
+			args = append(args, "--exclude="+pattern)
+		}
+		if len(opts.Include) > 0 {
+			args = append(args, "--include=*/")
+			for _, pattern := range opts.Include {
+				args = append(args, "--include="+pattern)
+			}
+			args = append(args, "--exclude=*", "--prune-empty-dirs")
+		}
+		args = append(args, src+"/", dst)
+	}
+
+	return builtin(name, args, func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		env := environFrom(ctx)
+		return copyTree(env.path(src), env.path(dst), opts)
+	})
+}
+
+func copyTree(src, dst string, opts CopyOptions) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		// like cp, a file copied to a directory keeps its name.
+		if dfi, err := os.Stat(dst); err == nil && dfi.IsDir() {
+			dst = filepath.Join(dst, filepath.Base(src))
+		}
+		return copyFile(src, dst)
+	}
+
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		target := filepath.Join(dst, rel)
+
+		if rel != "." && matchAny(opts.Exclude, rel) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case fi.IsDir() && len(opts.Include) > 0:
+			// directories are created as needed for included files.
+			return nil
+		case fi.IsDir():
+			return os.MkdirAll(target, fi.Mode().Perm()|0700) //nolint: gomnd
+		case len(opts.Include) > 0 && !matchAny(opts.Include, rel):
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil { //nolint: gomnd
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return copyLink(path, target)
+		}
+		return copyFile(path, target)
+	})
+}
+
+// copyLink recreates the symbolic link src at dst, replacing any
+// existing file.
+func copyLink(src, dst string) error {
+	link, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(link, dst)
+}
+
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := doublestar.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Move renames a file or directory, like "mv". Moves across devices
+// are done by copying and then removing the source.
+func Move(src, dst string) Task {
+	return builtin("mv", []string{src, dst}, func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		env := environFrom(ctx)
+		src, dst := env.path(src), env.path(dst)
+		err := os.Rename(src, dst)
+		if errors.Is(err, syscall.EXDEV) {
+			if err = copyTree(src, dst, CopyOptions{}); err == nil {
+				err = os.RemoveAll(src)
+			}
+		}
+		return err
+	})
+}
+
+// Remove removes the files or directory trees, like "rm -rf". It is
+// not an error if the paths do not exist.
+func Remove(paths ...string) Task {
+	return builtin("rm -rf", paths, func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		env := environFrom(ctx)
+		for _, path := range paths {
+			if err := os.RemoveAll(env.path(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Chmod changes the mode of the files, like "chmod".
+func Chmod(mode os.FileMode, paths ...string) Task {
+	args := append([]string{fmt.Sprintf("%o", mode)}, paths...)
+	return builtin("chmod", args, func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		env := environFrom(ctx)
+		for _, path := range paths {
+			if err := os.Chmod(env.path(path), mode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Symlink creates a symbolic link to target, like "ln -s". The
+// target is used as is: relative targets are relative to the
+// directory of the link.
+func Symlink(target, link string) Task {
+	return builtin("ln -s", []string{target, link}, func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		return os.Symlink(target, environFrom(ctx).path(link))
+	})
+}
+
+// Touch creates the files if they do not exist and updates their
+// modification time otherwise, like "touch".
+func Touch(paths ...string) Task {
+	return builtin("touch", paths, func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		env := environFrom(ctx)
+		now := time.Now()
+		for _, path := range paths {
+			f, err := os.OpenFile(env.path(path), os.O_WRONLY|os.O_CREATE, 0666) //nolint: gomnd
+			if err != nil {
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			if err := os.Chtimes(env.path(path), now, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteFile writes the data to the file atomically: the data is
+// written to a temporary file in the same directory which is then
+// renamed.  Readers never see a partially written file.
+func WriteFile(path string, data []byte, perm os.FileMode) Task {
+	shell := "printf %s " + shQuote(string(data)) + " > " + shQuote(path)
+	return Describe(shell, Func(func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		return writeAtomic(environFrom(ctx).path(path), data, perm)
+	}))
+}
+
+// Template renders the text/template text with the data and writes
+// the result to the file atomically, as with WriteFile.
+//
+// The template is rendered when planning for DryRun, so that the plan
+// includes the contents of the file.
+func Template(path, text string, data interface{}) Task {
+	t := &templated{path: path, text: text, data: data}
+	t.Task = Func(func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		data, err := t.render()
+		if err != nil {
+			return err
+		}
+		return writeAtomic(environFrom(ctx).path(path), data, 0666) //nolint: gomnd
+	})
+	return t
+}
+
+type templated struct {
+	Task
+	path, text string
+	data       interface{}
+}
+
+func (t *templated) render() ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(t.path)).Parse(t.text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, t.data)
+	return buf.Bytes(), err
+}
+
+func (t *templated) instance() Task {
+	result := *t
+	result.Task = instance(t.Task)
+	return &result
+}
+
+// Stdin is a no-op as templates do not read input.
+func (t *templated) Stdin(r io.Reader) Task {
+	return t
+}
+
+// Stdout is a no-op as templates do not produce output.
+func (t *templated) Stdout(w io.Writer) Task {
+	return t
+}
+
+// Stderr is a no-op as templates do not produce diagnostic output.
+func (t *templated) Stderr(w io.Writer) Task {
+	return t
+}
+
+func (t *templated) plan(ctx context.Context, eval bool) (*plan, error) {
+	data, err := t.render()
+	if err != nil {
+		return nil, err
+	}
+	return planOf(ctx, WriteFile(t.path, data, 0666), eval) //nolint: gomnd
+}
+
+func (t *templated) String() string {
+	return describe(t)
+}
+
+// writeAtomic writes data to a temporary file and renames it to path.
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,219 @@
+package script_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleWithLog() {
+	logger := log.New(os.Stdout, "", 0)
+	dir, err := ioutil.TempDir("", "example")
+	if err != nil {
+		fmt.Println("error", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	task := script.Dir(dir, script.Sequence(
+		script.WithLog(logger, script.Mkdir("out")),
+		script.WithLog(logger, script.WriteFile("out/hello.txt", []byte("hello\n"), 0644)),
+		script.WithLog(logger, script.Copy("out", "backup")),
+	))
+	if err := script.Run(context.Background(), task); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// > mkdir -p out
+	// > printf %s 'hello
+	// ' > out/hello.txt
+	// > cp -R out/. backup
+}
+
+func ExampleCopyWith() {
+	opts := script.CopyOptions{Include: []string{"**/*.go"}, Exclude: []string{"testdata"}}
+	task := script.Sequence(
+		script.Remove("dist"),
+		script.CopyWith(opts, "src", "dist"),
+		script.Chmod(0755, "dist/run.sh"),
+	)
+	if err := script.DryRunShell(context.Background(), os.Stdout, task); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output: rm -rf dist && rsync -a --exclude=testdata '--include=*/' '--include=**/*.go' '--exclude=*' --prune-empty-dirs src/ dist && chmod 755 dist/run.sh
+}
+
+func ExampleTemplate() {
+	task := script.Template("VERSION", "v{{.Major}}.{{.Minor}}\n", map[string]int{"Major": 1, "Minor": 2})
+	if err := script.DryRunShell(context.Background(), os.Stdout, task); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// printf %s 'v1.2
+	// ' > VERSION
+}
+
+func TestFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	run := func(tasks ...script.Task) {
+		t.Helper()
+		if err := script.Run(context.Background(), script.Dir(dir, script.Sequence(tasks...))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(path string) string {
+		t.Helper()
+		data, err := ioutil.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	run(
+		script.Mkdir("src/a/b", "src/testdata"),
+		script.WriteFile("src/a/b/x.go", []byte("x"), 0600),
+		script.WriteFile("src/a/y.txt", []byte("y"), 0644),
+		script.Touch("src/testdata/z.go", "src/run.sh"),
+		script.Template("src/v.go", "package {{.}}", "main"),
+	)
+	if s := read("src/v.go"); s != "package main" {
+		t.Error("Unexpected", s)
+	}
+
+	opts := script.CopyOptions{Include: []string{"**/*.go"}, Exclude: []string{"testdata"}}
+	run(
+		script.Copy("src", "all"),
+		script.CopyWith(opts, "src", "go"),
+		script.Copy("src/a/y.txt", "y.txt"),
+	)
+	if got, expected := tree(t, filepath.Join(dir, "all")), tree(t, filepath.Join(dir, "src")); !reflect.DeepEqual(got, expected) {
+		t.Error("Unexpected", got, expected)
+	}
+	if got := tree(t, filepath.Join(dir, "go")); !reflect.DeepEqual(got, []string{"a/b/x.go", "v.go"}) {
+		t.Error("Unexpected", got)
+	}
+	if s := read("y.txt"); s != "y" {
+		t.Error("Unexpected", s)
+	}
+
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(filepath.Join(dir, "go/a/b/x.go"))
+		if err != nil || fi.Mode().Perm() != 0600 {
+			t.Error("Unexpected mode", fi.Mode(), err)
+		}
+
+		run(script.Chmod(0755, "src/run.sh"), script.Symlink("a/y.txt", "src/link"))
+		if fi, err := os.Stat(filepath.Join(dir, "src/run.sh")); err != nil || fi.Mode().Perm() != 0755 {
+			t.Error("Unexpected mode", fi.Mode(), err)
+		}
+		if s := read("src/link"); s != "y" {
+			t.Error("Unexpected", s)
+		}
+	}
+
+	run(script.Move("src", "moved"), script.Remove("all", "missing"))
+	if names := readDir(t, dir); !reflect.DeepEqual(names, []string{"go", "moved", "y.txt"}) {
+		t.Error("Unexpected", names)
+	}
+
+	err := script.Run(context.Background(), script.Copy(filepath.Join(dir, "missing"), filepath.Join(dir, "x")))
+	if !os.IsNotExist(err) {
+		t.Error("Unexpected", err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	for _, s := range []string{"first", "second"} {
+		if err := script.Run(context.Background(), script.WriteFile(path, []byte(s), 0644)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readDir(t, dir); !reflect.DeepEqual(got, []string{"file"}) {
+		t.Error("Temporary files left behind", got)
+	}
+	if data, err := ioutil.ReadFile(path); string(data) != "second" || err != nil {
+		t.Error("Unexpected", string(data), err)
+	}
+
+	if err := script.Run(context.Background(), script.WriteFile(filepath.Join(dir, "missing", "file"), nil, 0644)); err == nil {
+		t.Error("Unexpected success")
+	}
+}
+
+// tree returns the paths of all the files within dir.
+func TestCopyLinksAndDirs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	dir := t.TempDir()
+	run := func(tasks ...script.Task) {
+		t.Helper()
+		if err := script.Run(context.Background(), script.Dir(dir, script.Sequence(tasks...))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(
+		script.Mkdir("src/d", "existing"),
+		script.WriteFile("src/d/f.txt", []byte("f"), 0644),
+		script.Symlink("d", "src/link"),
+		script.Copy("src", "out"),
+		// copying again replaces the links.
+		script.Copy("src", "out"),
+		script.Copy("src/d/f.txt", "existing"),
+	)
+	if link, err := os.Readlink(filepath.Join(dir, "out/link")); err != nil || link != "d" {
+		t.Error("Unexpected", link, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "existing/f.txt")); err != nil || string(data) != "f" {
+		t.Error("Unexpected", string(data), err)
+	}
+}
+
+func tree(t *testing.T, dir string) []string {
+	t.Helper()
+	var result []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if !fi.IsDir() {
+			result = append(result, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func readDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(entries))
+	for kk, entry := range entries {
+		names[kk] = entry.Name()
+	}
+	return names
+}
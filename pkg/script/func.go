@@ -6,29 +6,31 @@ import (
 )
 
 type fn struct {
-	f      func(ctx context.Context, r io.Reader, w io.Writer) error
-	ch     chan error
+	f      func(ctx context.Context, r io.Reader, w, errw io.Writer) error
+	bg     *background
 	stdin  io.Reader
 	stdout io.Writer
+	stderr io.Writer
 }
 
 func (f *fn) Start(ctx context.Context) error {
-	f.ch = make(chan error, 1)
-	go func() {
-		var err error
-		defer func() {
-			f.ch <- err
-		}()
-		err = f.f(ctx, f.stdin, f.stdout)
-	}()
+	f.bg = runBackground(ctx, func(ctx context.Context) error {
+		return f.f(ctx, f.stdin, f.stdout, f.stderr)
+	})
 	return nil
 }
 
+// Wait returns as soon as the context is done, even if the function
+// does not respect cancellation.
 func (f fn) Wait(ctx context.Context) error {
-	if f.ch != nil {
-		return <-f.ch
+	if f.bg == nil {
+		return nil
 	}
-	return nil
+	return f.bg.wait(ctx, true)
+}
+
+func (f fn) instance() Task {
+	return &fn{f: f.f, stdin: f.stdin, stdout: f.stdout, stderr: f.stderr}
 }
 
 func (f fn) Stdin(r io.Reader) Task {
@@ -42,3 +44,17 @@ func (f fn) Stdout(w io.Writer) Task {
 	result.stdout = w
 	return &result
 }
+
+func (f fn) Stderr(w io.Writer) Task {
+	result := f
+	result.stderr = w
+	return &result
+}
+
+func (f *fn) plan(ctx context.Context, eval bool) (*plan, error) {
+	return &plan{label: "func", shell: "func", opaque: true}, nil
+}
+
+func (f *fn) String() string {
+	return describe(f)
+}
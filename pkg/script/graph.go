@@ -0,0 +1,319 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// Target is a named node of a Graph.
+type Target struct {
+	// Name identifies the target.
+	Name string
+
+	// Deps are the names of the targets which must be built
+	// before this one.
+	Deps []string
+
+	// Inputs are the glob patterns (such as "**/*.go") of the
+	// files used by the task.
+	Inputs []string
+
+	// Outputs are the files produced by the task.
+	Outputs []string
+
+	// Task builds the target. It can be nil for targets which
+	// only group other targets.
+	Task Task
+}
+
+// Graph is a set of targets with dependencies between them, much
+// like a Makefile.
+//
+// Relative paths in Inputs and Outputs are resolved against the
+// working directory of the task (see Dir).
+type Graph struct {
+	targets map[string]Target
+}
+
+// NewGraph creates a graph with the provided targets.
+func NewGraph(targets ...Target) *Graph {
+	g := &Graph{map[string]Target{}}
+	g.Add(targets...)
+	return g
+}
+
+// Add adds targets to the graph, replacing any existing targets of
+// the same name.
+func (g *Graph) Add(targets ...Target) {
+	for _, t := range targets {
+		g.targets[t.Name] = t
+	}
+}
+
+// Build returns a task which builds the named targets along with
+// their dependencies.
+//
+// Targets are run as soon as all their dependencies are built, so
+// independent targets run in parallel. Each target is run at most
+// once per run of the task.
+//
+// A target is skipped if it has outputs, all of which are newer than
+// its inputs, and none of its dependencies were run. Targets without
+// outputs are always run.
+//
+// If any target fails, no further targets are started and the
+// returned error is Errors.
+func (g *Graph) Build(names ...string) Task {
+	return &build{g: g, names: names}
+}
+
+// sorted returns the named targets and all their dependencies in
+// topological order.
+func (g *Graph) sorted(names []string) ([]Target, error) {
+	var result []Target
+	state := map[string]int{} // 1 = visiting, 2 = done
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("script: dependency cycle %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		t, ok := g.targets[name]
+		if !ok {
+			if len(path) > 0 {
+				return fmt.Errorf("script: unknown target %q needed by %q", name, path[len(path)-1])
+			}
+			return fmt.Errorf("script: unknown target %q", name)
+		}
+
+		state[name] = 1
+		for _, dep := range t.Deps {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		result = append(result, t)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// upToDate checks if all the outputs of the target are newer than
+// its inputs.
+func (t Target) upToDate(env environ) (bool, error) {
+	if len(t.Outputs) == 0 {
+		return false, nil
+	}
+
+	var oldest time.Time
+	for kk, output := range t.Outputs {
+		fi, err := os.Stat(env.path(output))
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if kk == 0 || fi.ModTime().Before(oldest) {
+			oldest = fi.ModTime()
+		}
+	}
+
+	for _, input := range t.Inputs {
+		matches, err := doublestar.Glob(env.path(input))
+		if err != nil {
+			return false, err
+		}
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil {
+				return false, err
+			}
+			if fi.ModTime().After(oldest) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+type build struct {
+	g              *Graph
+	names          []string
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	bg             *background
+}
+
+type buildResult struct {
+	name string
+	ran  bool
+	err  error
+}
+
+func (b *build) Start(ctx context.Context) error {
+	b.bg = runBackground(ctx, b.run)
+	return nil
+}
+
+func (b *build) Wait(ctx context.Context) error {
+	if b.bg == nil {
+		return nil
+	}
+	return b.bg.wait(ctx, false)
+}
+
+func (b *build) run(ctx context.Context) error {
+	targets, err := b.g.sorted(b.names)
+	if err != nil {
+		return err
+	}
+
+	pending := map[string]int{}
+	dependents := map[string][]Target{}
+	for _, t := range targets {
+		pending[t.Name] = len(t.Deps)
+		for _, dep := range t.Deps {
+			dependents[dep] = append(dependents[dep], t)
+		}
+	}
+
+	results := make(chan buildResult, len(targets))
+	ranDeps := map[string]bool{}
+	running := 0
+	start := func(t Target) {
+		running++
+		force := ranDeps[t.Name]
+		go func() {
+			ran, err := b.runTarget(ctx, t, force)
+			results <- buildResult{t.Name, ran, err}
+		}()
+	}
+
+	for _, t := range targets {
+		if pending[t.Name] == 0 {
+			start(t)
+		}
+	}
+
+	var errs []error
+	for running > 0 {
+		r := <-results
+		running--
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.name, r.err))
+			continue
+		}
+		for _, t := range dependents[r.name] {
+			ranDeps[t.Name] = ranDeps[t.Name] || r.ran
+			if pending[t.Name]--; pending[t.Name] == 0 && len(errs) == 0 {
+				start(t)
+			}
+		}
+	}
+	return collectErrors(errs)
+}
+
+// runTarget runs the task of the target unless it is up to date. It
+// returns whether the task was run.  Targets without a task are
+// considered to have run only if one of their deps ran.
+func (b *build) runTarget(ctx context.Context, t Target, force bool) (bool, error) {
+	if t.Task == nil {
+		return force, nil
+	}
+	if !force {
+		if ok, err := t.upToDate(environFrom(ctx)); ok || err != nil {
+			return false, err
+		}
+	}
+	return true, Run(ctx, b.redirect(t.Task))
+}
+
+func (b *build) redirect(t Task) Task {
+	if b.stdin != nil {
+		t = t.Stdin(b.stdin)
+	}
+	if b.stdout != nil {
+		t = t.Stdout(b.stdout)
+	}
+	if b.stderr != nil {
+		t = t.Stderr(b.stderr)
+	}
+	return t
+}
+
+func (b *build) instance() Task {
+	return &build{g: b.g, names: b.names, stdin: b.stdin, stdout: b.stdout, stderr: b.stderr}
+}
+
+func (b *build) Stdin(r io.Reader) Task {
+	return &build{g: b.g, names: b.names, stdin: r, stdout: b.stdout, stderr: b.stderr}
+}
+
+func (b *build) Stdout(w io.Writer) Task {
+	return &build{g: b.g, names: b.names, stdin: b.stdin, stdout: w, stderr: b.stderr}
+}
+
+func (b *build) Stderr(w io.Writer) Task {
+	return &build{g: b.g, names: b.names, stdin: b.stdin, stdout: b.stdout, stderr: w}
+}
+
+func (b *build) plan(ctx context.Context, eval bool) (*plan, error) {
+	targets, err := b.g.sorted(b.names)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &plan{label: "build " + strings.Join(b.names, " ")}
+	var shells []*plan
+	for _, t := range targets {
+		node := &plan{label: "target " + t.Name}
+		if len(t.Deps) > 0 {
+			deps := append([]string(nil), t.Deps...)
+			sort.Strings(deps)
+			node.label += " (after " + strings.Join(deps, ", ") + ")"
+		}
+		if eval {
+			if ok, _ := t.upToDate(environFrom(ctx)); ok {
+				node.label += " (up to date)"
+			}
+		}
+		if t.Task != nil {
+			p, err := planOf(ctx, t.Task, eval)
+			if err != nil {
+				return nil, err
+			}
+			node.children = []*plan{p}
+			shells = append(shells, p)
+		}
+		result.children = append(result.children, node)
+	}
+
+	if len(shells) == 0 {
+		result.shell = "true"
+		return result, nil
+	}
+	joinedShell := joined("", " && ", shAndOr, shells)
+	result.shell, result.level = joinedShell.shell, joinedShell.level
+	return result, nil
+}
+
+func (b *build) String() string {
+	return describe(b)
+}
@@ -0,0 +1,161 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleGraph() {
+	g := script.NewGraph(
+		script.Target{Name: "all", Deps: []string{"test", "lint"}},
+		script.Target{Name: "generate", Task: script.Cmd("echo", "generate")},
+		script.Target{Name: "test", Deps: []string{"generate"}, Task: script.Cmd("echo", "test")},
+		script.Target{Name: "lint", Deps: []string{"generate"}, Task: script.Cmd("echo", "lint")},
+	)
+	err := script.Run(context.Background(), g.Build("all"))
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Unordered output:
+	// generate
+	// test
+	// lint
+}
+
+func TestGraphUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	ran := []string{}
+	record := func(name string) script.Task {
+		return script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	g := script.NewGraph(
+		script.Target{
+			Name:    "gen",
+			Inputs:  []string{"src/**/*.txt"},
+			Outputs: []string{"out/gen.txt"},
+			Task: script.Sequence(
+				script.Cmd("mkdir", "-p", "out"),
+				script.Pipe(script.Cmd("cat", "src/a/in.txt"), script.File("out/gen.txt")),
+				record("gen"),
+			),
+		},
+		// an empty group does not force its dependents to run.
+		script.Target{Name: "tools"},
+		script.Target{
+			Name:    "build",
+			Deps:    []string{"gen", "tools"},
+			Inputs:  []string{"out/gen.txt"},
+			Outputs: []string{"out/build.txt"},
+			Task: script.Sequence(
+				script.Pipe(script.File("out/gen.txt"), script.File("out/build.txt")),
+				record("build"),
+			),
+		},
+	)
+
+	if err := os.MkdirAll(filepath.Join(dir, "src", "a"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "src", "a", "in.txt")
+	if err := ioutil.WriteFile(input, []byte("hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() string {
+		ran = []string{}
+		if err := script.Run(context.Background(), script.Dir(dir, g.Build("build"))); err != nil {
+			t.Fatal("build failed", err)
+		}
+		return strings.Join(ran, ",")
+	}
+
+	if got := run(); got != "gen,build" {
+		t.Error("unexpected first run", got)
+	}
+	if got := run(); got != "" {
+		t.Error("unexpected second run", got)
+	}
+
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(input, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(); got != "gen,build" {
+		t.Error("unexpected run after touch", got)
+	}
+}
+
+func TestGraphParallel(t *testing.T) {
+	a, b := make(chan struct{}), make(chan struct{})
+	signal := func(send, receive chan struct{}) script.Task {
+		return script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+			close(send)
+			select {
+			case <-receive:
+				return nil
+			case <-time.After(5 * time.Second):
+				return errors.New("not run in parallel")
+			}
+		})
+	}
+
+	g := script.NewGraph(
+		script.Target{Name: "all", Deps: []string{"a", "b"}},
+		script.Target{Name: "a", Task: signal(a, b)},
+		script.Target{Name: "b", Task: signal(b, a)},
+	)
+	if err := script.Run(context.Background(), g.Build("all")); err != nil {
+		t.Error("unexpected", err)
+	}
+}
+
+func TestGraphErrors(t *testing.T) {
+	someErr := errors.New("some error")
+	ran := false
+	g := script.NewGraph(
+		script.Target{Name: "cycle", Deps: []string{"cycle2"}},
+		script.Target{Name: "cycle2", Deps: []string{"cycle"}},
+		script.Target{Name: "missing", Deps: []string{"goop"}},
+		script.Target{Name: "fail", Task: script.Error(someErr)},
+		script.Target{Name: "after", Deps: []string{"fail"}, Task: script.Func(
+			func(ctx context.Context, r io.Reader, w io.Writer) error {
+				ran = true
+				return nil
+			},
+		)},
+	)
+
+	for _, name := range []string{"cycle", "missing", "goop"} {
+		if err := script.Run(context.Background(), g.Build(name)); err == nil {
+			t.Error("unexpected success", name)
+		}
+	}
+
+	if err := script.Run(context.Background(), g.Build("after")); !errors.Is(err, someErr) || ran {
+		t.Error("unexpected", err, ran)
+	}
+}
@@ -0,0 +1,170 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func TestTaskReuse(t *testing.T) {
+	var count int32
+	counter := script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(time.Millisecond)
+		_, err := io.Copy(w, r)
+		return err
+	})
+	upper := script.Pipe(script.Echo("hello"), counter, script.Replace("hello", "HELLO"))
+	cond := script.If(script.Cmd("true"), upper, script.Echo("unexpected"))
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), []byte("HELLO\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := map[string]script.Task{
+		"func":     script.Pipe(script.Echo("HELLO"), counter),
+		"cmd":      script.Cmd("echo", "HELLO"),
+		"pipe":     upper,
+		"if":       cond,
+		"sequence": script.Sequence(counter, upper),
+		"retry":    script.Retry(script.RetryPolicy{}, upper),
+		"timeout":  script.Timeout(time.Minute, cond),
+		"dir":      script.Dir(".", cond),
+		"file":     script.File(filepath.Join(dir, "file")),
+		"tee":      script.Pipe(script.Echo("HELLO"), script.Tee(filepath.Join(dir, "tee"))),
+		"cached":   (&script.Cache{Disabled: true}).Cached(nil, nil, upper),
+		"prefixed": script.Pipe(script.Prefixed("p", upper), script.Replace("^p \\| ", "")),
+	}
+
+	for name, task := range tasks {
+		t.Run(name, func(t *testing.T) {
+			// run in sequence and concurrently, including
+			// multiple times within the same parallel task.
+			for kk := 0; kk < 2; kk++ {
+				if out, err := script.Output(context.Background(), task); out != "HELLO\n" || err != nil {
+					t.Fatalf("Unexpected %q %v", out, err)
+				}
+			}
+
+			var wg sync.WaitGroup
+			for kk := 0; kk < 4; kk++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					out, err := script.Output(context.Background(), script.Parallel(task, task))
+					if out != "HELLO\nHELLO\n" || err != nil {
+						t.Errorf("Unexpected %q %v", out, err)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+
+	if count == 0 {
+		t.Error("Func never ran")
+	}
+}
+
+func TestTaskReuseConcurrent(t *testing.T) {
+	var count int32
+	counter := script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&count, 1)
+		return nil
+	})
+
+	// the tasks are run without redirecting their output so that
+	// the same task values are started.
+	tasks := map[string]struct {
+		task  script.Task
+		count int32
+	}{
+		"func":     {counter, 1},
+		"cmd":      {script.Sequence(script.Cmd("true"), counter), 1},
+		"pipe":     {script.Pipe(counter, counter), 2},
+		"if":       {script.If(counter, counter, nil), 2},
+		"sequence": {script.Sequence(counter, counter), 2},
+		"retry":    {script.Retry(script.RetryPolicy{}, counter), 1},
+		"timeout":  {script.Timeout(time.Minute, counter), 1},
+		"dir":      {script.Dir(".", counter), 1},
+		"cached":   {(&script.Cache{Disabled: true}).Cached(nil, nil, counter), 1},
+		"prefixed": {script.Prefixed("p", counter), 1},
+	}
+
+	for name, test := range tasks {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt32(&count, 0)
+			var wg sync.WaitGroup
+			for kk := 0; kk < 4; kk++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					task := script.Parallel(test.task, test.task, test.task)
+					if err := script.Run(context.Background(), task); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := atomic.LoadInt32(&count); got != 12*test.count {
+				t.Error("Unexpected count", got)
+			}
+		})
+	}
+}
+
+func TestPipeRedirectImmutable(t *testing.T) {
+	ctx := context.Background()
+	sorted := script.Pipe(script.Cat(), script.Sort())
+	a := sorted.Stdin(strings.NewReader("b\na\n"))
+	b := sorted.Stdin(strings.NewReader("d\nc\n"))
+
+	lines, err := script.Lines(ctx, a)
+	if err != nil || !reflect.DeepEqual(lines, []string{"a", "b"}) {
+		t.Error("Unexpected", lines, err)
+	}
+	lines, err = script.Lines(ctx, b)
+	if err != nil || !reflect.DeepEqual(lines, []string{"c", "d"}) {
+		t.Error("Unexpected", lines, err)
+	}
+}
+
+func TestRetryReusesTask(t *testing.T) {
+	dir := t.TempDir()
+	attempt := 0
+	flaky := script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		if attempt++; attempt%2 == 1 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	task := script.Retry(script.RetryPolicy{MaxAttempts: 2}, script.Sequence(
+		flaky,
+		script.Pipe(script.Echo("done"), script.AppendFile(filepath.Join(dir, "log"))),
+	))
+
+	for kk := 0; kk < 3; kk++ {
+		if err := script.Run(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "log"))
+	lines := strings.Fields(string(data))
+	sort.Strings(lines)
+	if err != nil || attempt != 6 || len(lines) != 3 {
+		t.Error("Unexpected", attempt, lines, err)
+	}
+}
@@ -0,0 +1,43 @@
+package script
+
+import (
+	"context"
+	"io"
+)
+
+// merged ties the stderr of a task to its stdout.
+type merged struct {
+	Task
+}
+
+func (m merged) instance() Task {
+	return merged{instance(m.Task)}
+}
+
+func (m merged) unwrap() Task {
+	return m.Task
+}
+
+func (m merged) Stdin(r io.Reader) Task {
+	return merged{m.Task.Stdin(r)}
+}
+
+func (m merged) Stdout(w io.Writer) Task {
+	return merged{m.Task.Stdout(w).Stderr(w)}
+}
+
+func (m merged) Stderr(w io.Writer) Task {
+	return m
+}
+
+func (m merged) plan(ctx context.Context, eval bool) (*plan, error) {
+	p, err := planOf(ctx, m.Task, eval)
+	if err != nil {
+		return nil, err
+	}
+	return &plan{label: "2>&1", shell: p.wrap(shCommand) + " 2>&1", children: []*plan{p}}, nil
+}
+
+func (m merged) String() string {
+	return describe(m)
+}
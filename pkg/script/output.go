@@ -0,0 +1,99 @@
+package script
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Output runs the task and returns its output. This works with any
+// task including pipes, where the output of the last task is
+// returned.
+//
+// The output collected so far is returned even if the task fails.
+func Output(ctx context.Context, t Task) (string, error) {
+	var buf lockedBuffer
+	err := Run(ctx, t.Stdout(&buf))
+	return buf.String(), err
+}
+
+// lockedBuffer is a buffer which is safe for concurrent writes, such
+// as from the tasks of Parallel.
+type lockedBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *lockedBuffer) String() string {
+	l.Lock()
+	defer l.Unlock()
+	return l.buf.String()
+}
+
+// Bytes returns a copy of the contents of the buffer.
+func (l *lockedBuffer) Bytes() []byte {
+	l.Lock()
+	defer l.Unlock()
+	return append([]byte(nil), l.buf.Bytes()...)
+}
+
+// TrimmedOutput is like Output but with leading and trailing
+// whitespace removed.
+func TrimmedOutput(ctx context.Context, t Task) (string, error) {
+	out, err := Output(ctx, t)
+	return strings.TrimSpace(out), err
+}
+
+// Lines runs the task and returns its output split into lines. Line
+// endings ("\n" or "\r\n") are not included.
+func Lines(ctx context.Context, t Task) ([]string, error) {
+	out, err := Output(ctx, t)
+	lines := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Buffer(nil, len(out)+1)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, err
+}
+
+// DecodeJSON runs the task and decodes its output as JSON into v.
+func DecodeJSON(ctx context.Context, t Task, v interface{}) error {
+	out, err := Output(ctx, t)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(out), v)
+}
+
+// DecodeJSONEach runs the task and calls fn with each JSON value in
+// its output.  This is useful with commands like "go list -json"
+// which output a sequence of JSON values.
+//
+// Iteration stops if fn returns an error.
+func DecodeJSONEach(ctx context.Context, t Task, fn func(raw json.RawMessage) error) error {
+	out, err := Output(ctx, t)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(out))
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
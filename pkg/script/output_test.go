@@ -0,0 +1,63 @@
+package script_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleOutput() {
+	out, err := script.TrimmedOutput(context.Background(), script.Pipe(
+		script.Cmd("echo", "hello"),
+		script.Cmd("sed", "s/hello/world/"),
+	))
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	fmt.Printf("%q\n", out)
+
+	// Output: "world"
+}
+
+func ExampleLines() {
+	lines, err := script.Lines(context.Background(), script.Cmd("printf", "a\nb\r\n\nc"))
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	fmt.Printf("%q\n", lines)
+
+	// Output: ["a" "b" "" "c"]
+}
+
+func ExampleDecodeJSON() {
+	var v struct{ Name string }
+	err := script.DecodeJSON(context.Background(), script.Cmd("echo", `{"Name": "hello"}`), &v)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	fmt.Println(v.Name)
+
+	// Output: hello
+}
+
+func ExampleDecodeJSONEach() {
+	err := script.DecodeJSONEach(
+		context.Background(),
+		script.Cmd("echo", `{"Name": "hello"} {"Name": "world"}`),
+		func(raw json.RawMessage) error {
+			var v struct{ Name string }
+			err := json.Unmarshal(raw, &v)
+			fmt.Println(v.Name)
+			return err
+		},
+	)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// hello
+	// world
+}
@@ -24,21 +24,44 @@ func (p parallel) Wait(ctx context.Context) error {
 			err = err2
 		}
 	}
-	return err
+	return waitErr(ctx, err)
+}
+
+func (p parallel) instance() Task {
+	return parallel(instances(p))
 }
 
+// Stdin provides each task with all of the input.
 func (p parallel) Stdin(r io.Reader) Task {
+	return &broadcast{tasks: p, stdin: r}
+}
+
+func (p parallel) Stdout(w io.Writer) Task {
 	result := make(parallel, len(p))
 	for kk := range p {
-		result[kk] = p[kk].Stdin(r)
+		result[kk] = p[kk].Stdout(w)
 	}
 	return result
 }
 
-func (p parallel) Stdout(w io.Writer) Task {
+func (p parallel) Stderr(w io.Writer) Task {
 	result := make(parallel, len(p))
 	for kk := range p {
-		result[kk] = p[kk].Stdout(w)
+		result[kk] = p[kk].Stderr(w)
 	}
 	return result
 }
+
+func (p parallel) plan(ctx context.Context, eval bool) (*plan, error) {
+	children, err := plansOf(ctx, p, eval)
+	if err != nil {
+		return nil, err
+	}
+	result := joined("parallel", " & ", shList, children)
+	result.shell += " & wait"
+	return result, nil
+}
+
+func (p parallel) String() string {
+	return describe(p)
+}
@@ -0,0 +1,162 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ParallelOptions configures ParallelWith.
+type ParallelOptions struct {
+	// Limit is the maximum number of tasks run at the same
+	// time. Zero means no limit.
+	Limit int
+
+	// FailFast cancels all other tasks when a task fails. Tasks
+	// not yet started are skipped.
+	FailFast bool
+}
+
+// ParallelWith is like Parallel but with bounded concurrency and
+// optional fail-fast cancellation.
+//
+// If any task fails, the returned error is Errors holding all the
+// failures in the order of the tasks. With FailFast, failures of
+// the tasks which were cancelled are not included.
+//
+// Input provided via Stdin is broadcast like with Parallel.  With a
+// Limit, the input is held in memory for tasks waiting for their
+// turn.
+func ParallelWith(opts ParallelOptions, tasks ...Task) Task {
+	return &parallelWith{opts: opts, tasks: tasks}
+}
+
+type parallelWith struct {
+	opts  ParallelOptions
+	tasks []Task
+	stdin io.Reader
+	bg    *background
+}
+
+func (p *parallelWith) Start(ctx context.Context) error {
+	p.bg = runBackground(ctx, p.run)
+	return nil
+}
+
+func (p *parallelWith) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limit := p.opts.Limit
+	if limit <= 0 {
+		limit = len(p.tasks)
+	}
+	sem := make(chan struct{}, limit)
+
+	// the input of tasks which wait for their turn is not bounded
+	// as the running tasks may otherwise never get all of theirs.
+	var fan *fanout
+	if p.stdin != nil {
+		buffer := 0
+		if limit >= len(p.tasks) {
+			buffer = fanoutBuffer
+		}
+		fan = newFanout(ctx, p.stdin, len(p.tasks), buffer)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	cancelled := false
+	errs := make([]error, len(p.tasks))
+	for kk := range p.tasks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			if fan != nil {
+				for ; kk < len(p.tasks); kk++ {
+					fan.done(kk)
+				}
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func(kk int) {
+			defer wg.Done()
+			t := p.tasks[kk]
+			if fan != nil {
+				t = t.Stdin(fan.reader(kk))
+				defer fan.done(kk)
+			}
+			err := Run(ctx, t)
+			<-sem
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && !cancelled {
+				errs[kk] = err
+				if p.opts.FailFast {
+					cancelled = true
+					cancel()
+				}
+			}
+		}(kk)
+	}
+	wg.Wait()
+
+	if result := collectErrors(errs); result != nil {
+		return result
+	}
+	return ctx.Err()
+}
+
+func (p *parallelWith) Wait(ctx context.Context) error {
+	if p.bg == nil {
+		return nil
+	}
+	return p.bg.wait(ctx, false)
+}
+
+func (p *parallelWith) instance() Task {
+	return &parallelWith{opts: p.opts, tasks: p.tasks, stdin: p.stdin}
+}
+
+// Stdin provides each task with all of the input.
+func (p *parallelWith) Stdin(r io.Reader) Task {
+	return &parallelWith{opts: p.opts, tasks: p.tasks, stdin: r}
+}
+
+func (p *parallelWith) Stdout(w io.Writer) Task {
+	return &parallelWith{opts: p.opts, tasks: parallel(p.tasks).Stdout(w).(parallel), stdin: p.stdin}
+}
+
+func (p *parallelWith) Stderr(w io.Writer) Task {
+	return &parallelWith{opts: p.opts, tasks: parallel(p.tasks).Stderr(w).(parallel), stdin: p.stdin}
+}
+
+func (p *parallelWith) plan(ctx context.Context, eval bool) (*plan, error) {
+	result, err := parallel(p.tasks).plan(ctx, eval)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []string{}
+	if p.opts.Limit > 0 {
+		opts = append(opts, fmt.Sprintf("limit %d", p.opts.Limit))
+	}
+	if p.opts.FailFast {
+		opts = append(opts, "fail-fast")
+	}
+	if len(opts) > 0 {
+		result.label += " (" + strings.Join(opts, ", ") + ")"
+	}
+	return result, nil
+}
+
+func (p *parallelWith) String() string {
+	return describe(p)
+}
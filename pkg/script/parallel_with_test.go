@@ -0,0 +1,85 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleParallelWith() {
+	spec := script.ParallelWith(
+		script.ParallelOptions{Limit: 1},
+		script.Cmd("echo", "hello"),
+		script.Cmd("false"),
+		script.Cmd("echo", "world"),
+		script.Cmd("sh", "-c", "exit 2"),
+	)
+	err := script.Run(context.Background(), spec)
+	fmt.Println(err)
+
+	// Output:
+	// hello
+	// world
+	// false: exit status 1
+	// sh -c exit 2: exit status 2
+}
+
+func TestParallelWithLimit(t *testing.T) {
+	var mu sync.Mutex
+	running, max := 0, 0
+	task := func(ctx context.Context, r io.Reader, w io.Writer) error {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+
+	tasks := []script.Task{}
+	for kk := 0; kk < 20; kk++ {
+		tasks = append(tasks, script.Func(task))
+	}
+	err := script.Run(context.Background(), script.ParallelWith(script.ParallelOptions{Limit: 3}, tasks...))
+	if err != nil || max > 3 {
+		t.Error("unexpected", err, max)
+	}
+}
+
+func TestParallelWithFailFast(t *testing.T) {
+	someErr := errors.New("some error")
+	start := time.Now()
+	spec := script.ParallelWith(
+		script.ParallelOptions{Limit: 2, FailFast: true},
+		script.Cmd("sleep", "10"),
+		script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+			return someErr
+		}),
+		script.Cmd("sleep", "10"),
+	)
+	err := script.Run(context.Background(), spec)
+
+	var errs script.Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0] != someErr {
+		t.Error("unexpected error", err)
+	}
+	if !errors.Is(err, someErr) {
+		t.Error("unexpected errors.Is", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("siblings were not cancelled")
+	}
+}
@@ -7,24 +7,37 @@ import (
 )
 
 type pipe struct {
-	tasks            []Task
+	tasks []Task
+
+	// running, writers and readers hold the state of a run. These
+	// are allocated upfront as pipe is not a pointer.
+	running          []Task
 	writers, readers []*os.File
 }
 
+func newPipe(tasks []Task) pipe {
+	return pipe{
+		tasks:   tasks,
+		running: make([]Task, len(tasks)),
+		writers: make([]*os.File, len(tasks)-1),
+		readers: make([]*os.File, len(tasks)-1),
+	}
+}
+
 func (p pipe) Start(ctx context.Context) error {
-	for kk := range p.tasks[1:] {
+	copy(p.running, p.tasks)
+	for kk := range p.running[1:] {
 		r, w, err := os.Pipe()
 		if err != nil {
 			return err
 		}
 		p.writers[kk] = w
 		p.readers[kk] = r
-		p.tasks[kk] = p.tasks[kk].Stdout(w)
-		p.tasks[kk+1] = p.tasks[kk+1].Stdin(r)
+		p.running[kk] = p.running[kk].Stdout(w)
+		p.running[kk+1] = p.running[kk+1].Stdin(r)
 	}
-
-	for kk := range p.tasks {
-		if err := p.tasks[kk].Start(ctx); err != nil {
+	for kk := range p.running {
+		if err := p.running[kk].Start(ctx); err != nil {
 			if kk > 0 {
 				p.readers[kk-1].Close()
 				p.readers[kk-1] = nil
@@ -35,44 +48,124 @@ func (p pipe) Start(ctx context.Context) error {
 	return nil
 }
 
+// Wait waits for all the tasks concurrently.  Once a task finishes,
+// its input is closed so that earlier tasks do not block writing to
+// it.  Like the shell, those tasks failing to write their output as
+// a result are not considered to have failed.
 func (p pipe) Wait(ctx context.Context) error {
-	var err error
-	for kk, t := range p.tasks {
-		if err2 := t.Wait(ctx); err2 != nil {
-			err = err2
-		}
+	if len(p.running) == 0 || p.running[0] == nil {
+		return nil
+	}
+	errs := make([]error, len(p.running))
+	done := make(chan int, len(p.running))
+	for kk, t := range p.running {
+		go func(kk int, t Task) {
+			errs[kk] = t.Wait(ctx)
+			done <- kk
+		}(kk, t)
+	}
+
+	finished := make([]bool, len(p.running))
+	abandoned := make([]bool, len(p.running))
+	for range p.running {
+		kk := <-done
+		finished[kk] = true
 		if kk < len(p.writers) {
 			p.writers[kk].Close()
 		}
 		if kk > 0 {
 			p.readers[kk-1].Close()
+			abandoned[kk-1] = !finished[kk-1]
 		}
 	}
-	return err
-}
 
-func (p pipe) Stdin(r io.Reader) Task {
-	writers := make([]*os.File, len(p.tasks)-1)
-	readers := make([]*os.File, len(p.tasks)-1)
-	result := pipe{p.tasks, writers, readers}
-	for kk := range p.tasks {
-		result.tasks[kk] = p.tasks[kk]
-		if kk == 0 {
-			result.tasks[kk] = p.tasks[kk].Stdin(r)
+	failed := false
+	for kk, err := range errs {
+		if abandoned[kk] && brokenPipe(err) {
+			errs[kk] = nil
 		}
+		if errs[kk] != nil {
+			failed = true
+		}
+	}
+	if failed {
+		return waitErr(ctx, &PipeError{errs})
 	}
-	return result
+	return nil
+}
+
+func (p pipe) Stdin(r io.Reader) Task {
+	tasks := append([]Task(nil), p.tasks...)
+	tasks[0] = tasks[0].Stdin(r)
+	return newPipe(tasks)
 }
 
 func (p pipe) Stdout(w io.Writer) Task {
-	writers := make([]*os.File, len(p.tasks)-1)
-	readers := make([]*os.File, len(p.tasks)-1)
-	result := pipe{p.tasks, writers, readers}
+	tasks := append([]Task(nil), p.tasks...)
+	tasks[len(tasks)-1] = tasks[len(tasks)-1].Stdout(w)
+	return newPipe(tasks)
+}
+
+// Stderr redirects the diagnostic output of all the tasks in the
+// pipe.
+func (p pipe) Stderr(w io.Writer) Task {
+	tasks := make([]Task, len(p.tasks))
 	for kk := range p.tasks {
-		result.tasks[kk] = p.tasks[kk]
-		if kk == len(p.tasks)-1 {
-			result.tasks[kk] = p.tasks[kk].Stdout(w)
+		tasks[kk] = p.tasks[kk].Stderr(w)
+	}
+	return newPipe(tasks)
+}
+
+func (p pipe) instance() Task {
+	return newPipe(instances(p.tasks))
+}
+
+func (p pipe) plan(ctx context.Context, eval bool) (*plan, error) {
+	children, err := plansOf(ctx, p.tasks, eval)
+	if err != nil {
+		return nil, err
+	}
+
+	// files after the first stage are written to, not read from.
+	for kk, t := range p.tasks[1:] {
+		if f, ok := t.(*file); ok {
+			children[kk+1] = f.redirect(true)
 		}
 	}
-	return result
+
+	// render files at the ends of the pipe as redirections.
+	var in, out string
+	stages := children
+	if _, ok := p.tasks[0].(*file); ok && len(stages) > 1 {
+		in = stages[0].shell + " "
+		stages = stages[1:]
+	}
+	if _, ok := p.tasks[len(p.tasks)-1].(*file); ok && len(p.tasks) > 1 {
+		out = " " + stages[len(stages)-1].shell
+		stages = stages[:len(stages)-1]
+		if len(stages) == 0 {
+			// copying between two files.
+			stages = []*plan{{label: "cat", shell: "cat"}}
+		}
+
+		// "2>&1" must follow the output redirection.
+		if _, ok := p.tasks[len(p.tasks)-2].(merged); ok {
+			stages = append([]*plan{}, stages...)
+			last := stages[len(stages)-1]
+			stages[len(stages)-1] = last.children[0]
+			out += " 2>&1"
+		}
+	}
+
+	result := joined("pipe", " | ", shPipeline, stages)
+	if len(stages) == 1 {
+		result.level = stages[0].level
+	}
+	result.shell = in + result.shell + out
+	result.children = children
+	return result, nil
+}
+
+func (p pipe) String() string {
+	return describe(p)
 }
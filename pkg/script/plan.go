@@ -0,0 +1,285 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// DryRun prints the plan of the task as an indented tree, without
+// running anything.
+//
+// Conditions of If (and Or) tasks are not evaluated, so both
+// branches are printed.  Conditions marked via Safe are the
+// exception: these are run and only the chosen branch is printed.
+func DryRun(ctx context.Context, w io.Writer, t Task) error {
+	p, err := planOf(ctx, t, true)
+	if err != nil {
+		return err
+	}
+	return p.print(w, "")
+}
+
+// DryRunShell is like DryRun but prints the plan as shell-equivalent
+// text.
+func DryRunShell(ctx context.Context, w io.Writer, t Task) error {
+	p, err := planOf(ctx, t, true)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, p.shell)
+	return err
+}
+
+// Safe marks a task as safe to run during DryRun. This is meant for
+// side-effect free conditions of If tasks, such as "test -f path".
+func Safe(t Task) Task {
+	return safe{t}
+}
+
+// Describe provides a description of the task for use with DryRun
+// and String. This is useful with Func tasks which cannot be
+// described otherwise.
+func Describe(description string, t Task) Task {
+	return described{t, description}
+}
+
+// plan is the description of a task.
+type plan struct {
+	// label is used with the tree view.
+	label string
+
+	// shell is the shell equivalent.
+	shell string
+
+	// level is the precedence of the shell text: one of
+	// shCommand, shPipeline, shAndOr or shList.
+	level int
+
+	children []*plan
+
+	// opaque is set if the shell text does not describe the
+	// task, as with Func.
+	opaque bool
+}
+
+// planner is implemented by tasks which can describe themselves.
+//
+// If eval is set, conditions marked Safe are evaluated.
+type planner interface {
+	plan(ctx context.Context, eval bool) (*plan, error)
+}
+
+func planOf(ctx context.Context, t Task, eval bool) (*plan, error) {
+	if p, ok := t.(planner); ok {
+		return p.plan(ctx, eval)
+	}
+	s := fmt.Sprintf("%T", t)
+	if stringer, ok := t.(fmt.Stringer); ok {
+		s = stringer.String()
+	}
+	return &plan{label: s, shell: s}, nil
+}
+
+// plansOf returns the plans of all the tasks.
+func plansOf(ctx context.Context, tasks []Task, eval bool) ([]*plan, error) {
+	result := make([]*plan, len(tasks))
+	for kk, t := range tasks {
+		p, err := planOf(ctx, t, eval)
+		if err != nil {
+			return nil, err
+		}
+		result[kk] = p
+	}
+	return result, nil
+}
+
+// describe returns the shell equivalent of a task.
+func describe(t Task) string {
+	p, err := planOf(context.Background(), t, false)
+	if err != nil {
+		return err.Error()
+	}
+	return p.shell
+}
+
+// isOpaque checks if the plan or any of its children is opaque.
+func (p *plan) isOpaque() bool {
+	if p.opaque {
+		return true
+	}
+	for _, child := range p.children {
+		if child.isOpaque() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *plan) print(w io.Writer, indent string) error {
+	if _, err := fmt.Fprintln(w, indent+p.label); err != nil {
+		return err
+	}
+	for _, child := range p.children {
+		if err := child.print(w, indent+"  "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Precedence levels of shell text.
+const (
+	shCommand = iota
+	shPipeline
+	shAndOr
+	shList
+)
+
+// wrap returns the shell text, wrapped in braces if its precedence
+// is lower than the provided level.
+func (p *plan) wrap(level int) string {
+	if p.level <= level {
+		return p.shell
+	}
+	return "{ " + p.shell + "; }"
+}
+
+// command returns the shell text in a form usable as the arguments
+// of a command like "timeout".
+func (p *plan) command() string {
+	if p.level == shCommand {
+		return p.shell
+	}
+	return "sh -c " + shQuote(p.shell)
+}
+
+// joined creates a compound plan by joining the children with an
+// operator of the provided level.  All but the first child must have
+// a higher precedence than the operator.
+func joined(label, op string, level int, children []*plan) *plan {
+	shells := make([]string, len(children))
+	for kk, child := range children {
+		if kk == 0 {
+			shells[kk] = child.wrap(level)
+		} else {
+			shells[kk] = child.wrap(level - 1)
+		}
+	}
+	return &plan{label: label, shell: strings.Join(shells, op), level: level, children: children}
+}
+
+var shSafeWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`) //nolint: gochecknoglobals
+
+// shQuote quotes a word for the shell, if needed.
+func shQuote(s string) string {
+	if shSafeWord.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+type safe struct {
+	Task
+}
+
+func (s safe) plan(ctx context.Context, eval bool) (*plan, error) {
+	return planOf(ctx, s.Task, eval)
+}
+
+func (s safe) String() string {
+	return describe(s)
+}
+
+func (s safe) instance() Task {
+	return safe{instance(s.Task)}
+}
+
+func (s safe) unwrap() Task {
+	return s.Task
+}
+
+func (s safe) Stdin(r io.Reader) Task {
+	return safe{s.Task.Stdin(r)}
+}
+
+func (s safe) Stdout(w io.Writer) Task {
+	return safe{s.Task.Stdout(w)}
+}
+
+func (s safe) Stderr(w io.Writer) Task {
+	return safe{s.Task.Stderr(w)}
+}
+
+type described struct {
+	Task
+	description string
+}
+
+func (d described) plan(ctx context.Context, eval bool) (*plan, error) {
+	return &plan{label: d.description, shell: d.description}, nil
+}
+
+func (d described) String() string {
+	return d.description
+}
+
+func (d described) instance() Task {
+	return described{instance(d.Task), d.description}
+}
+
+func (d described) unwrap() Task {
+	return d.Task
+}
+
+func (d described) Stdin(r io.Reader) Task {
+	return described{d.Task.Stdin(r), d.description}
+}
+
+func (d described) Stdout(w io.Writer) Task {
+	return described{d.Task.Stdout(w), d.description}
+}
+
+func (d described) Stderr(w io.Writer) Task {
+	return described{d.Task.Stderr(w), d.description}
+}
+
+type logged struct {
+	Task
+	logger Logger
+}
+
+func (l logged) Start(ctx context.Context) error {
+	l.logger.Println(">", describe(l.Task))
+	return l.Task.Start(ctx)
+}
+
+func (l logged) plan(ctx context.Context, eval bool) (*plan, error) {
+	return planOf(ctx, l.Task, eval)
+}
+
+func (l logged) String() string {
+	return describe(l)
+}
+
+func (l logged) instance() Task {
+	return logged{instance(l.Task), l.logger}
+}
+
+func (l logged) unwrap() Task {
+	return l.Task
+}
+
+func (l logged) Stdin(r io.Reader) Task {
+	return logged{l.Task.Stdin(r), l.logger}
+}
+
+func (l logged) Stdout(w io.Writer) Task {
+	return logged{l.Task.Stdout(w), l.logger}
+}
+
+func (l logged) Stderr(w io.Writer) Task {
+	return logged{l.Task.Stderr(w), l.logger}
+}
@@ -0,0 +1,109 @@
+package script_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleDryRun() {
+	spec := script.Sequence(
+		script.Cmd("go", "build", "./..."),
+		script.Parallel(
+			script.Dir("cmd", script.Cmd("go", "test", "./...")),
+			script.Pipe(
+				script.Cmd("go", "vet", "./..."),
+				script.File("vet.txt"),
+			),
+		),
+		script.If(
+			script.Safe(script.Cmd("test", "-d", "/")),
+			script.Cmd("rm", "-rf", "dist"),
+			script.Cmd("echo", "no root?"),
+		),
+		script.Or(
+			script.Cmd("git", "push"),
+			script.Describe("notify failure", script.Func(nil)),
+		),
+	)
+	err := script.DryRun(context.Background(), os.Stdout, spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// sequence
+	//   go build ./...
+	//   parallel
+	//     cd cmd
+	//       go test ./...
+	//     pipe
+	//       go vet ./...
+	//       > vet.txt
+	//   # test -d / succeeded
+	//     rm -rf dist
+	//   if
+	//     git push
+	//     else
+	//       notify failure
+}
+
+func ExampleDryRunShell() {
+	spec := script.Sequence(
+		script.Env([]string{"GOOS=linux"}, script.Cmd("go", "build", "./...")),
+		script.Parallel(
+			script.Dir("cmd", script.Cmd("go", "test", "./...")),
+			script.Pipe(
+				script.MergeStderr(script.Cmd("go", "vet", "./...")),
+				script.File("vet.txt"),
+			),
+		),
+		script.If(
+			script.Safe(script.Cmd("false")),
+			script.Cmd("rm", "-rf", "dist"),
+			script.Cmd("echo", "it's false"),
+		),
+	)
+	err := script.DryRunShell(context.Background(), os.Stdout, spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	fmt.Println(script.Sh("echo hello | tr a-z A-Z > out.txt && echo ok || echo fail"))
+
+	// Output:
+	// GOOS=linux go build ./... && { (cd cmd && go test ./...) & go vet ./... > vet.txt 2>&1 & wait; } && echo 'it'\''s false'
+	// echo hello | tr a-z A-Z > out.txt && echo ok || echo fail
+}
+
+func ExampleDryRun_files() {
+	spec := script.Sequence(
+		script.Pipe(script.Cmd("echo", "hi"), script.File("/tmp/x")),
+		script.Pipe(script.Cmd("date"), script.AppendFile("/tmp/log")),
+		script.Pipe(script.File("/tmp/x"), script.Cmd("wc", "-l")),
+		script.Pipe(script.File("/tmp/x"), script.File("/tmp/y")),
+	)
+	if err := script.DryRun(context.Background(), os.Stdout, spec); err != nil {
+		fmt.Println("error", err)
+	}
+	if err := script.DryRunShell(context.Background(), os.Stdout, spec); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// sequence
+	//   pipe
+	//     echo hi
+	//     > /tmp/x
+	//   pipe
+	//     date
+	//     >> /tmp/log
+	//   pipe
+	//     < /tmp/x
+	//     wc -l
+	//   pipe
+	//     < /tmp/x
+	//     > /tmp/y
+	// echo hi > /tmp/x && date >> /tmp/log && < /tmp/x wc -l && < /tmp/x cat > /tmp/y
+}
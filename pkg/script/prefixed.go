@@ -0,0 +1,178 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// outputMu serializes the writes of all prefixed tasks so that lines
+// are never interleaved.
+var outputMu sync.Mutex //nolint: gochecknoglobals
+
+// PrefixOptions configures PrefixedWith.
+type PrefixOptions struct {
+	// Color is the ANSI color code (such as 31 for red) used for
+	// the prefix. Zero implies no color.
+	Color int
+
+	// Grouped holds back all output till the task finishes and
+	// then writes it contiguously.  Note that Parallel waits for
+	// its tasks in order, so the output appears in task order.
+	// ParallelWith writes the output as each task finishes.
+	Grouped bool
+}
+
+// Prefixed line-buffers the stdout and stderr of the task and
+// prefixes each line with the name, like "name | line". This keeps
+// the output of tasks run via Parallel readable.
+func Prefixed(name string, t Task) Task {
+	return PrefixedWith(name, PrefixOptions{}, t)
+}
+
+// PrefixedWith is like Prefixed but with options for color and
+// grouping output.
+func PrefixedWith(name string, opts PrefixOptions, t Task) Task {
+	return &prefixed{name: name, opts: opts, task: t, stdout: os.Stdout, stderr: os.Stderr}
+}
+
+type prefixed struct {
+	name           string
+	opts           PrefixOptions
+	task           Task
+	stdout, stderr io.Writer
+	running        Task
+	out, errw      *prefixWriter
+}
+
+func (p *prefixed) Start(ctx context.Context) error {
+	prefix := p.name + " | "
+	if p.opts.Color != 0 {
+		prefix = fmt.Sprintf("\x1b[%dm%s\x1b[0m", p.opts.Color, prefix)
+	}
+	p.out = &prefixWriter{prefix: prefix, w: p.stdout, grouped: p.opts.Grouped}
+	p.errw = &prefixWriter{prefix: prefix, w: p.stderr, grouped: p.opts.Grouped}
+	p.running = p.task.Stdout(p.out).Stderr(p.errw)
+	return p.running.Start(ctx)
+}
+
+func (p *prefixed) Wait(ctx context.Context) error {
+	if p.running == nil {
+		return nil
+	}
+	err := p.running.Wait(ctx)
+
+	// the writers are locked before outputMu, as in Write, since
+	// abandoned tasks may still be writing.
+	p.out.Lock()
+	defer p.out.Unlock()
+	p.errw.Lock()
+	defer p.errw.Unlock()
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	p.out.flush()
+	p.errw.flush()
+	return err
+}
+
+func (p *prefixed) instance() Task {
+	return &prefixed{name: p.name, opts: p.opts, task: instance(p.task), stdout: p.stdout, stderr: p.stderr}
+}
+
+func (p *prefixed) unwrap() Task {
+	return p.task
+}
+
+func (p *prefixed) Stdin(r io.Reader) Task {
+	result := *p
+	result.task = p.task.Stdin(r)
+	return &result
+}
+
+func (p *prefixed) Stdout(w io.Writer) Task {
+	result := *p
+	result.stdout = w
+	return &result
+}
+
+func (p *prefixed) Stderr(w io.Writer) Task {
+	result := *p
+	result.stderr = w
+	return &result
+}
+
+// prefixWriter writes complete lines with a prefix. If grouped, the
+// lines are held back till flush.
+type prefixWriter struct {
+	sync.Mutex
+	prefix  string
+	w       io.Writer
+	grouped bool
+	partial []byte
+	group   bytes.Buffer
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	n := len(data)
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, '\n')
+		if idx == -1 {
+			p.partial = append(p.partial, data...)
+			break
+		}
+		line := append(p.partial, data[:idx+1]...)
+		p.partial = nil
+		data = data[idx+1:]
+		if err := p.writeLine(line); err != nil {
+			return n - len(data), err
+		}
+	}
+	return n, nil
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	if p.grouped {
+		p.group.WriteString(p.prefix)
+		p.group.Write(line)
+		return nil
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	_, err := p.w.Write(append([]byte(p.prefix), line...))
+	return err
+}
+
+// flush writes out any partial line and grouped output. It must be
+// called with the lock of the writer and outputMu held.
+func (p *prefixWriter) flush() {
+	if len(p.partial) > 0 {
+		p.group.WriteString(p.prefix)
+		p.group.Write(p.partial)
+		p.group.WriteString("\n")
+		p.partial = nil
+	}
+	if p.group.Len() > 0 {
+		_, _ = p.w.Write(p.group.Bytes())
+		p.group.Reset()
+	}
+}
+
+func (p *prefixed) plan(ctx context.Context, eval bool) (*plan, error) {
+	inner, err := planOf(ctx, p.task, eval)
+	if err != nil {
+		return nil, err
+	}
+	shell := inner.wrap(shPipeline) + " | sed " + shQuote("s/^/"+p.name+" | /")
+	return &plan{label: "prefix " + p.name, shell: shell, level: shPipeline, children: []*plan{inner}}, nil
+}
+
+func (p *prefixed) String() string {
+	return describe(p)
+}
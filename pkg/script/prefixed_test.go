@@ -0,0 +1,85 @@
+package script_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExamplePrefixed() {
+	spec := script.Parallel(
+		script.Prefixed("one", script.Cmd("sh", "-c", "printf 'hel'; sleep 0.01; echo lo; printf partial")),
+		script.Prefixed("two", script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+			fmt.Fprint(w, "wor")
+			time.Sleep(5 * time.Millisecond)
+			fmt.Fprintln(w, "ld")
+			return nil
+		})),
+	)
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Unordered output:
+	// one | hello
+	// one | partial
+	// two | world
+}
+
+func ExamplePrefixedWith_grouped() {
+	opts := script.PrefixOptions{Grouped: true}
+	spec := script.ParallelWith(
+		script.ParallelOptions{},
+		script.PrefixedWith("slow", opts, script.Cmd("sh", "-c", "echo a; sleep 0.02; echo b")),
+		script.PrefixedWith("fast", opts, script.Cmd("sh", "-c", "echo c; echo d")),
+	)
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// fast | c
+	// fast | d
+	// slow | a
+	// slow | b
+}
+
+func TestPrefixedAbandonedWrites(t *testing.T) {
+	// the func ignores cancellation and keeps writing while Wait
+	// flushes the output.
+	writer := func(stop *int32) script.Task {
+		return script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+			for atomic.LoadInt32(stop) == 0 {
+				fmt.Fprint(w, "partial")
+				fmt.Fprintln(w, " line")
+			}
+			return nil
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for kk := 0; kk < 30; kk++ {
+			var stop int32
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+			_ = script.Run(ctx, script.Prefixed("p", writer(&stop)).Stdout(ioutil.Discard))
+			cancel()
+			atomic.StoreInt32(&stop, 1)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("deadlock")
+	}
+}
@@ -0,0 +1,98 @@
+package script_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+// openPty opens a pseudo terminal, returning its master and slave.
+func openPty(t *testing.T) (*os.File, *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("no pseudo terminals", err)
+	}
+	var unlock int32
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		t.Fatal(errno)
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		t.Fatal(errno)
+	}
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master, slave
+}
+
+// TestCmdForegroundTerminal runs TestCmdForegroundTerminalHelper in
+// a new session with a pseudo terminal as its controlling terminal
+// and stdin.
+func TestCmdForegroundTerminal(t *testing.T) {
+	if _, err := exec.LookPath("ps"); err != nil {
+		t.Skip("ps not available")
+	}
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+
+	var out bytes.Buffer
+	helper := exec.Command(os.Args[0], "-test.run=^TestCmdForegroundTerminalHelper$", "-test.v")
+	helper.Env = append(os.Environ(), "SCRIPT_TTY_HELPER=1")
+	helper.Stdin, helper.Stdout, helper.Stderr = slave, &out, &out
+	helper.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := helper.Run(); err != nil || !strings.Contains(out.String(), "--- PASS") {
+		t.Error("Unexpected", err, out.String())
+	}
+}
+
+func TestCmdForegroundTerminalHelper(t *testing.T) {
+	if os.Getenv("SCRIPT_TTY_HELPER") == "" {
+		t.Skip("run by TestCmdForegroundTerminal")
+	}
+	self := syscall.Getpgrp()
+	foreground := func() string {
+		task := script.Cmd("ps", "-o", "tpgid=", "-p", strconv.Itoa(os.Getpid())).Stdin(nil)
+		out, err := script.Output(context.Background(), task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(out)
+	}
+
+	// the command gets its own process group, which is the
+	// foreground of the terminal while it runs.
+	task := script.Cmd("sh", "-c", "ps -o pgid=,tpgid= -p $$").Stdin(os.Stdin)
+	out, err := script.Output(context.Background(), task)
+	ids := strings.Fields(out)
+	if err != nil || len(ids) != 2 || ids[0] == fmt.Sprint(self) || ids[0] != ids[1] {
+		t.Error("Unexpected process groups", self, out, err)
+	}
+	if fg := foreground(); fg != fmt.Sprint(self) {
+		t.Error("Foreground not restored", self, fg)
+	}
+
+	// descendants are stopped when cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = script.Output(ctx, script.Cmd("sh", "-c", "sleep 30 & wait").Stdin(os.Stdin))
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Error("Descendants not stopped", err, time.Since(start))
+	}
+	if fg := foreground(); fg != fmt.Sprint(self) {
+		t.Error("Foreground not restored", self, fg)
+	}
+}
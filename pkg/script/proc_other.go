@@ -0,0 +1,40 @@
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package script
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op as process groups are not supported.
+func setProcessGroup(c *exec.Cmd, stdin io.Reader) {
+}
+
+// releaseTerminal is a no-op as process groups are not supported.
+func releaseTerminal(c *exec.Cmd) {
+}
+
+// terminateGroup kills the command as there is no portable way to
+// ask it to exit.
+func terminateGroup(c *exec.Cmd) {
+	_ = c.Process.Kill()
+}
+
+// killGroup kills the command.
+func killGroup(c *exec.Cmd) {
+	_ = c.Process.Kill()
+}
+
+// groupAlive is always false as descendants cannot be tracked.
+func groupAlive(c *exec.Cmd) bool {
+	return false
+}
+
+// brokenPipe checks if the error is due to writing to a pipe which
+// has no readers.
+func brokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
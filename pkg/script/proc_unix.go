@@ -0,0 +1,112 @@
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package script
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// setProcessGroup runs the command in a new process group so that
+// the command and all its descendants can be signaled together.
+//
+// If stdin is the terminal of the Go program and the program is in
+// its foreground, the new group is placed in the foreground instead
+// so that it can read from the terminal and receive Ctrl-C.  Only
+// one command at a time is placed in the foreground; the terminal is
+// handed back by releaseTerminal.
+func setProcessGroup(c *exec.Cmd, stdin io.Reader) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Setpgid = true
+
+	f, ok := stdin.(*os.File)
+	if !ok {
+		return
+	}
+	fd := int(f.Fd())
+	if !foreground(fd) {
+		return
+	}
+
+	terminal.Lock()
+	defer terminal.Unlock()
+	if terminal.holder == nil {
+		terminal.holder = c
+		c.SysProcAttr.Foreground = true
+		c.SysProcAttr.Ctty = fd
+	}
+}
+
+// terminal tracks the command placed in the foreground of the
+// terminal, if any.
+var terminal struct { //nolint: gochecknoglobals
+	sync.Mutex
+	holder *exec.Cmd
+}
+
+// releaseTerminal places the process group of the Go program back in
+// the foreground if the command was placed there.
+func releaseTerminal(c *exec.Cmd) {
+	terminal.Lock()
+	defer terminal.Unlock()
+	if terminal.holder != c {
+		return
+	}
+	terminal.holder = nil
+
+	// like a shell, the program is not in the foreground and would
+	// be stopped by SIGTTOU unless it is ignored.
+	if !signal.Ignored(syscall.SIGTTOU) {
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+	}
+	_ = toForeground(c.SysProcAttr.Ctty)
+}
+
+// hasGroup checks if the command runs in its own process group.
+func hasGroup(c *exec.Cmd) bool {
+	return c.SysProcAttr != nil && c.SysProcAttr.Setpgid
+}
+
+// terminateGroup asks the process group of the command to exit.
+func terminateGroup(c *exec.Cmd) {
+	signalGroup(c, syscall.SIGTERM)
+}
+
+// killGroup forcibly stops the process group of the command.
+func killGroup(c *exec.Cmd) {
+	signalGroup(c, syscall.SIGKILL)
+}
+
+// signalGroup signals the process group of the command or just the
+// command if it does not have its own group.
+func signalGroup(c *exec.Cmd, sig syscall.Signal) {
+	if hasGroup(c) {
+		_ = syscall.Kill(-c.Process.Pid, sig)
+	} else {
+		_ = c.Process.Signal(sig)
+	}
+}
+
+// groupAlive checks if any process of the process group of the
+// command still exists.
+func groupAlive(c *exec.Cmd) bool {
+	return hasGroup(c) && syscall.Kill(-c.Process.Pid, 0) == nil
+}
+
+// brokenPipe checks if the error is due to writing to a pipe which
+// has no readers.
+func brokenPipe(err error) bool {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) && exitErr.Signal == syscall.SIGPIPE {
+		return true
+	}
+	return errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,119 @@
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package script_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func TestCmdCancelStopsDescendants(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// the grandchild holds stdout open, so Output would block
+	// until it exits.
+	start := time.Now()
+	_, err := script.Output(ctx, script.Cmd("sh", "-c", "sleep 30 & wait"))
+	if err == nil {
+		t.Error("Unexpected success")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Error("Descendants not stopped", elapsed)
+	}
+}
+
+func TestCmdCancelGraceful(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	out, _ := script.Output(ctx, script.Cmd("sh", "-c", "trap 'echo stopping; exit 0' TERM; sleep 30 & wait"))
+	if strings.TrimSpace(out) != "stopping" {
+		t.Errorf("Unexpected %q", out)
+	}
+}
+
+func TestCmdCancelKillsAfterGracePeriod(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// SIGTERM is ignored by the shell and its children.
+	task := script.Cmd("sh", "-c", "trap '' TERM; while :; do sleep 0.05; done")
+	start := time.Now()
+	err := script.Run(ctx, script.GracePeriod(300*time.Millisecond, task))
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Error("Unexpected success")
+	}
+	if elapsed < 500*time.Millisecond || elapsed > script.DefaultGracePeriod {
+		t.Error("Unexpected duration", elapsed)
+	}
+}
+
+func TestCmdCancelledBeforeStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := script.Run(ctx, script.Cmd("true")); err != context.Canceled {
+		t.Error("Unexpected", err)
+	}
+}
+
+func TestCmdWaitTwice(t *testing.T) {
+	ctx := context.Background()
+	task := script.Cmd("true")
+	if err := task.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Wait(ctx); err == nil {
+		t.Error("Unexpected success")
+	}
+}
+
+// pgids returns the process groups of the shell and its parent when
+// run with the provided stdin.
+func pgids(t *testing.T, stdin *os.File) []string {
+	task := script.Cmd("sh", "-c", "ps -o pgid= -p $$; ps -o pgid= -p $PPID").Stdin(stdin)
+	out, err := script.Output(context.Background(), task)
+	if err != nil {
+		t.Skip("ps not available", err)
+	}
+	return strings.Fields(out)
+}
+
+func TestCmdDevNullStdin(t *testing.T) {
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+
+	// /dev/null is not a terminal, so the command gets its own
+	// process group.
+	if ids := pgids(t, null); len(ids) != 2 || ids[0] == ids[1] {
+		t.Error("Unexpected process groups", ids)
+	}
+}
+
+func TestCmdOtherDeviceStdin(t *testing.T) {
+	// character devices which are not the terminal of the test,
+	// such as /dev/zero, do not affect the process group.
+	for _, path := range []string{"/dev/zero", "/dev/ptmx"} {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Log("skipping", path, err)
+			continue
+		}
+		if ids := pgids(t, f); len(ids) != 2 || ids[0] == ids[1] {
+			t.Error("Unexpected process groups", path, ids)
+		}
+		f.Close()
+	}
+}
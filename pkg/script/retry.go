@@ -0,0 +1,116 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/watch"
+)
+
+// RetryPolicy configures how Retry deals with failures. It is shared
+// with watch.RepeatWithRetry.
+type RetryPolicy = watch.RetryPolicy
+
+// Retry runs the task and reruns it on failure as per the policy.
+// Context errors are never retried.
+//
+// Each attempt restarts the task from scratch.  Note that any input
+// consumed by a failed attempt is not replayed.
+func Retry(policy RetryPolicy, t Task) Task {
+	return &retry{policy: policy, task: t}
+}
+
+type retry struct {
+	policy  RetryPolicy
+	task    Task
+	started bool
+	err     error
+}
+
+func (r *retry) Start(ctx context.Context) error {
+	r.started = true
+	r.err = r.task.Start(ctx)
+	return nil
+}
+
+func (r *retry) Wait(ctx context.Context) error {
+	if !r.started {
+		return nil
+	}
+
+	err := r.err
+	if err == nil {
+		err = r.task.Wait(ctx)
+	}
+	for attempt := 1; err != nil; attempt++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if r.policy.OnError != nil {
+			r.policy.OnError(err, attempt)
+		}
+		if r.policy.Retryable != nil && !r.policy.Retryable(err) {
+			return err
+		}
+		if r.policy.MaxAttempts > 0 && attempt >= r.policy.MaxAttempts {
+			return err
+		}
+		if !sleep(ctx, r.policy.BackoffAfter(attempt)) {
+			return ctx.Err()
+		}
+		err = Run(ctx, r.task)
+	}
+	return nil
+}
+
+func (r *retry) instance() Task {
+	return &retry{policy: r.policy, task: instance(r.task)}
+}
+
+func (r *retry) Stdin(rd io.Reader) Task {
+	return &retry{policy: r.policy, task: r.task.Stdin(rd)}
+}
+
+func (r *retry) Stdout(w io.Writer) Task {
+	return &retry{policy: r.policy, task: r.task.Stdout(w)}
+}
+
+func (r *retry) Stderr(w io.Writer) Task {
+	return &retry{policy: r.policy, task: r.task.Stderr(w)}
+}
+
+// sleep waits for the duration, returning false if the context is
+// done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (r *retry) plan(ctx context.Context, eval bool) (*plan, error) {
+	p, err := planOf(ctx, r.task, eval)
+	if err != nil {
+		return nil, err
+	}
+	delay := r.policy.BackoffAfter(1).Seconds()
+	if r.policy.MaxAttempts <= 0 {
+		shell := fmt.Sprintf("until %s; do sleep %v; done", p.wrap(shAndOr), delay)
+		return &plan{label: "retry", shell: shell, children: []*plan{p}}, nil
+	}
+
+	// the status of the loop is that of the last attempt.
+	label := fmt.Sprintf("retry (max %d attempts)", r.policy.MaxAttempts)
+	shell := fmt.Sprintf("for i in $(seq %d); do [ $i = 1 ] || sleep %v; %s && break; done", r.policy.MaxAttempts, delay, p.wrap(shPipeline))
+	return &plan{label: label, shell: shell, children: []*plan{p}}, nil
+}
+
+func (r *retry) String() string {
+	return describe(r)
+}
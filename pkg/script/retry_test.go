@@ -0,0 +1,115 @@
+package script_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleRetry() {
+	attempts := 0
+	flaky := script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		attempts++
+		fmt.Fprintln(w, "attempt", attempts)
+		if attempts < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+
+	policy := script.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	err := script.Run(context.Background(), script.Retry(policy, flaky))
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// attempt 1
+	// attempt 2
+	// attempt 3
+}
+
+func TestRetryPlan(t *testing.T) {
+	flaky := script.Cmd("flaky")
+	plans := map[string]script.Task{
+		"until flaky; do sleep 0.1; done":                                   script.Retry(script.RetryPolicy{}, flaky),
+		"for i in $(seq 3); do [ $i = 1 ] || sleep 2; flaky && break; done": script.Retry(script.RetryPolicy{MaxAttempts: 3, Backoff: 2 * time.Second}, flaky),
+	}
+	for expected, task := range plans {
+		var buf bytes.Buffer
+		if err := script.DryRunShell(context.Background(), &buf, task); err != nil || buf.String() != expected+"\n" {
+			t.Errorf("Unexpected %q %v", buf.String(), err)
+		}
+	}
+}
+
+func ExampleTimeout() {
+	spec := script.Or(
+		script.Timeout(10*time.Millisecond, script.Cmd("sleep", "10")),
+		script.Cmd("echo", "timed out"),
+	)
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output: timed out
+}
+
+func TestTimeoutError(t *testing.T) {
+	start := time.Now()
+	err := script.Run(context.Background(), script.Timeout(10*time.Millisecond, script.Cmd("sleep", "10")))
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Fatal("unexpected error", err)
+	}
+
+	var exitErr *script.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Signal == nil {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	someErr := errors.New("some error")
+	attempts := []int{}
+	policy := script.RetryPolicy{
+		MaxAttempts: 2,
+		OnError: func(err error, attempt int) {
+			attempts = append(attempts, attempt)
+		},
+	}
+	failing := script.Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		return someErr
+	})
+
+	if err := script.Run(context.Background(), script.Retry(policy, failing)); err != someErr {
+		t.Error("unexpected error", err)
+	}
+	if fmt.Sprint(attempts) != "[1 2]" {
+		t.Error("unexpected attempts", attempts)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	attempts := 0
+	policy := script.RetryPolicy{
+		MaxAttempts: 3,
+		Retryable: func(err error) bool {
+			attempts++
+			return errors.Is(err, context.DeadlineExceeded)
+		},
+	}
+	spec := script.Retry(policy, script.Timeout(time.Millisecond, script.Cmd("sleep", "10")))
+	if err := script.Run(context.Background(), spec); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("unexpected error", err)
+	}
+	if attempts != 3 {
+		t.Error("unexpected attempts", attempts)
+	}
+}
@@ -45,6 +45,55 @@
 // Non shell tasks can be mingled within via the `Func(...)` method.
 // When the Func task is used in a Pipe, its input and output are
 // provided via the reader and writer arg.
+//
+// Common text utilities are available as pure Go tasks which do not
+// depend on the corresponding programs being installed: Cat, Echo,
+// Grep, Replace, Head, Tail, Sort, Uniq, Wc and Tee:
+//
+//      task := script.Pipe(
+//          script.Echo("hello"),
+//          script.Replace("hello", "world"),
+//          script.Grep("world"),
+//      )
+//
+// Similarly, filesystem operations are available as tasks: Mkdir,
+// Copy, Move, Remove, Chmod, Symlink, Touch, WriteFile and Template.
+// These are described by their shell equivalents with DryRun and can
+// be logged via WithLog.
+//
+// A task can be run for each item of a dynamic list, such as the
+// lines of output of a command or the files matching a glob, via
+// ForEach:
+//
+//      task := script.ForEach(script.Glob("**/*.go"), func(path string) script.Task {
+//          return script.Cmd("gofmt", "-l", path)
+//      }, script.ForEachOptions{Limit: 4})
+//
+// Long running tasks such as servers can be wrapped with a readiness
+// probe via Service and kept running for the duration of another
+// task via With.  The service is stopped once the task finishes:
+//
+//      task := script.With(
+//          script.Service(script.Cmd("./server"), script.HTTPReady("http://localhost:8080/health")),
+//          script.Cmd("go", "test", "./e2e/..."),
+//      )
+//
+// Diagnostic output can be redirected via the `Stderr` method of
+// any task or merged into the regular output via `MergeStderr`:
+//
+//      task := script.Pipe(
+//          script.MergeStderr(script.Cmd("go", "vet", "./...")),
+//          script.File("/tmp/vet.txt"),
+//      )
+//
+// The working directory and environment of a task (including all its
+// sub-tasks) can be controlled via `Dir`, `Env` and `CleanEnv`
+// without affecting the current process:
+//
+//      task := script.Dir("testdata", script.Env(
+//          []string{"GOOS=linux"},
+//          script.Cmd("go", "build", "./..."),
+//      ))
 package script
 
 import (
@@ -54,6 +103,11 @@ import (
 )
 
 // Task defines a task that can be run.
+//
+// A task value describes what to run but Start and Wait hold the
+// state of a run on the value itself, so a task value should only be
+// started once at a time.  Run takes care of this by starting a fresh
+// instance of the task, as do tasks which run other tasks.
 type Task interface {
 	// Start starts a task asynchronously.
 	Start(ctx context.Context) error
@@ -61,6 +115,10 @@ type Task interface {
 	// Wait waits for the task to finish.
 	// Wait can be called before the task is started. In this
 	// case, it should do nothing and return nil.
+	//
+	// If the context is done, the running parts of the task are
+	// cancelled and Wait returns promptly with an error matching
+	// ctx.Err() via errors.Is.
 	Wait(ctx context.Context) error
 
 	// Stdin redirects input.
@@ -70,10 +128,18 @@ type Task interface {
 	// Stdout redirects output.
 	// This is immutable returning a new task.
 	Stdout(w io.Writer) Task
+
+	// Stderr redirects diagnostic output.
+	// This is immutable returning a new task.
+	Stderr(w io.Writer) Task
 }
 
 // Run runs a task.
+//
+// Each run uses a fresh instance of the task, so a task value can be
+// run any number of times, including concurrently.
 func Run(ctx context.Context, t Task) error {
+	t = instance(t)
 	err1 := t.Start(ctx)
 	err2 := t.Wait(ctx)
 	if err1 != nil {
@@ -82,23 +148,72 @@ func Run(ctx context.Context, t Task) error {
 	return err2
 }
 
+// instancer is implemented by tasks which hold state while running.
+type instancer interface {
+	// instance returns a copy of the task with no running state.
+	// Sub-tasks which are started via Run need not be copied as
+	// Run creates their instances.
+	instance() Task
+}
+
+// instance returns a fresh instance of the task. Tasks not
+// implementing instancer are returned as is.
+func instance(t Task) Task {
+	if i, ok := t.(instancer); ok {
+		return i.instance()
+	}
+	return t
+}
+
+func instances(tasks []Task) []Task {
+	result := make([]Task, len(tasks))
+	for kk, t := range tasks {
+		result[kk] = instance(t)
+	}
+	return result
+}
+
 // Sequence chains a sequence of tasks together. If any task fails,
 // the sequence is aborted.
+//
+// Input provided via Stdin is shared by the tasks: each task
+// consumes what it reads. See SequenceWith for replaying the input
+// to each task.
 func Sequence(tasks ...Task) Task {
 	return seq(tasks)
 }
 
+// SequenceOptions configures SequenceWith.
+type SequenceOptions struct {
+	// ReplayStdin buffers the input provided via Stdin and
+	// replays all of it to each task. By default, the tasks
+	// share the input stream.
+	ReplayStdin bool
+}
+
+// SequenceWith is like Sequence but with options to control how
+// input is provided to the tasks.
+func SequenceWith(opts SequenceOptions, tasks ...Task) Task {
+	if opts.ReplayStdin {
+		return &replaySeq{tasks: seq(tasks)}
+	}
+	return seq(tasks)
+}
+
 // Parallel runs all tasks in parallel. If any tasks fail, it returns
-// one of the errors.
+// one of the errors.  See ParallelWith for bounded concurrency and
+// reporting of all errors.
+//
+// Input provided via Stdin is broadcast: each task receives all of
+// it.
 func Parallel(tasks ...Task) Task {
 	return parallel(tasks)
 }
 
 // Pipe runs all tasks in a "pipe" chaining their input and outputs.
+// If any task fails, the returned error is a *PipeError.
 func Pipe(tasks ...Task) Task {
-	writers := make([]*os.File, len(tasks)-1)
-	readers := make([]*os.File, len(tasks)-1)
-	return pipe{tasks, writers, readers}
+	return newPipe(tasks)
 }
 
 // File runs a task which allows either input to be piped to it or for
@@ -107,6 +222,12 @@ func File(path string) Task {
 	return &file{path: path}
 }
 
+// AppendFile is like File but input piped to it is appended to the
+// file instead of replacing its contents.
+func AppendFile(path string) Task {
+	return &file{path: path, append: true}
+}
+
 // Or runs a sequence of commands until one succeeds.
 func Or(tasks ...Task) Task {
 	var result Task
@@ -135,8 +256,12 @@ func If(condition, thenTask, elseTask Task) Task {
 }
 
 // Cmd runs a program with the provided args.
+//
+// The program runs in its own process group. If the context is
+// cancelled, the program and all its descendants are stopped via
+// SIGTERM and then SIGKILL once the GracePeriod elapses.
 func Cmd(program string, args ...string) Task {
-	return &cmd{nil, program, args, os.Stdin, os.Stdout, os.Stderr, nil}
+	return &cmd{program: program, args: args, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
 }
 
 type Logger interface {
@@ -145,10 +270,33 @@ type Logger interface {
 
 // CmdWithLog runs a program with the provided args and also logs output.
 func CmdWithLog(logger Logger, program string, args ...string) Task {
-	return &cmd{logger, program, args, os.Stdin, os.Stdout, os.Stderr, nil}
+	return &cmd{logger: logger, program: program, args: args, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+}
+
+// WithLog logs the shell equivalent of the task when it starts, as
+// CmdWithLog does for commands.  This is meant for use with builtin
+// tasks such as Copy or WriteFile.
+func WithLog(logger Logger, t Task) Task {
+	return logged{t, logger}
 }
 
 // Func runs a task function.
 func Func(f func(ctx context.Context, r io.Reader, w io.Writer) error) Task {
-	return &fn{f, nil, os.Stdin, os.Stdout}
+	return FuncWithStderr(func(ctx context.Context, r io.Reader, w, _ io.Writer) error {
+		return f(ctx, r, w)
+	})
+}
+
+// FuncWithStderr runs a task function which also writes diagnostic
+// output to errw.
+func FuncWithStderr(f func(ctx context.Context, r io.Reader, w, errw io.Writer) error) Task {
+	return &fn{f, nil, os.Stdin, os.Stdout, os.Stderr}
+}
+
+// MergeStderr redirects the stderr of the task to wherever its
+// stdout goes, much like "2>&1" in the shell.
+//
+// Calling Stderr on the returned task has no effect.
+func MergeStderr(t Task) Task {
+	return merged{t.Stderr(os.Stdout)}
 }
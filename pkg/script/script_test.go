@@ -1,6 +1,7 @@
 package script_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -126,3 +127,38 @@ func ExampleFunc() {
 
 	// Output: hello
 }
+
+func ExampleMergeStderr() {
+	spec := script.Pipe(
+		script.MergeStderr(script.Cmd("sh", "-c", "echo oops >&2")),
+		script.Cmd("sed", "s/^/stderr: /"),
+	)
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output: stderr: oops
+}
+
+func ExampleFuncWithStderr() {
+	var buf bytes.Buffer
+	spec := script.Sequence(
+		script.FuncWithStderr(func(ctx context.Context, r io.Reader, w, errw io.Writer) error {
+			fmt.Fprintln(w, "to stdout")
+			fmt.Fprintln(errw, "to stderr")
+			return nil
+		}),
+		script.Cmd("sh", "-c", "echo from cmd >&2"),
+	).Stderr(&buf)
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	fmt.Print(buf.String())
+
+	// Output:
+	// to stdout
+	// to stderr
+	// from cmd
+}
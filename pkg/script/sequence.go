@@ -1,8 +1,11 @@
 package script
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"io/ioutil"
+	"sync"
 )
 
 type seq []Task
@@ -17,17 +20,26 @@ func (s seq) Start(ctx context.Context) error {
 func (s seq) Wait(ctx context.Context) error {
 	for kk := range s {
 		if kk > 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			if err := s[kk].Start(ctx); err != nil {
 				return err
 			}
 		}
 		if err := s[kk].Wait(ctx); err != nil {
-			return err
+			return waitErr(ctx, err)
 		}
 	}
 	return nil
 }
 
+func (s seq) instance() Task {
+	return seq(instances(s))
+}
+
+// Stdin shares the input between the tasks: each task consumes
+// what it reads and the rest is available to the subsequent tasks.
 func (s seq) Stdin(r io.Reader) Task {
 	result := make(seq, len(s))
 	for kk := range s {
@@ -43,3 +55,111 @@ func (s seq) Stdout(w io.Writer) Task {
 	}
 	return result
 }
+
+func (s seq) Stderr(w io.Writer) Task {
+	result := make(seq, len(s))
+	for kk := range s {
+		result[kk] = s[kk].Stderr(w)
+	}
+	return result
+}
+
+// replaySeq is a sequence where each task receives all of the input.
+type replaySeq struct {
+	tasks   seq
+	stdin   io.Reader
+	running seq
+}
+
+func (s *replaySeq) Start(ctx context.Context) error {
+	s.running = s.tasks
+	if s.stdin != nil {
+		buf := &replayBuffer{r: s.stdin}
+		s.running = make(seq, len(s.tasks))
+		for kk := range s.tasks {
+			s.running[kk] = s.tasks[kk].Stdin(buf.reader())
+		}
+	}
+	return s.running.Start(ctx)
+}
+
+func (s *replaySeq) Wait(ctx context.Context) error {
+	if s.running == nil {
+		return nil
+	}
+	return s.running.Wait(ctx)
+}
+
+func (s *replaySeq) instance() Task {
+	return &replaySeq{tasks: instances(s.tasks), stdin: s.stdin}
+}
+
+func (s *replaySeq) Stdin(r io.Reader) Task {
+	return &replaySeq{tasks: s.tasks, stdin: r}
+}
+
+func (s *replaySeq) Stdout(w io.Writer) Task {
+	return &replaySeq{tasks: s.tasks.Stdout(w).(seq), stdin: s.stdin}
+}
+
+func (s *replaySeq) Stderr(w io.Writer) Task {
+	return &replaySeq{tasks: s.tasks.Stderr(w).(seq), stdin: s.stdin}
+}
+
+// replayBuffer reads all of its input on first use and provides
+// readers which replay it.
+type replayBuffer struct {
+	once sync.Once
+	r    io.Reader
+	data []byte
+	err  error
+}
+
+func (b *replayBuffer) reader() io.Reader {
+	return &replayReader{b: b}
+}
+
+type replayReader struct {
+	b *replayBuffer
+	r *bytes.Reader
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	if r.r == nil {
+		r.b.once.Do(func() {
+			r.b.data, r.b.err = ioutil.ReadAll(r.b.r)
+		})
+		if r.b.err != nil {
+			return 0, r.b.err
+		}
+		r.r = bytes.NewReader(r.b.data)
+	}
+	return r.r.Read(p)
+}
+
+func (s seq) plan(ctx context.Context, eval bool) (*plan, error) {
+	children, err := plansOf(ctx, s, eval)
+	if err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return &plan{label: "sequence", shell: "true"}, nil
+	}
+	return joined("sequence", " && ", shAndOr, children), nil
+}
+
+func (s seq) String() string {
+	return describe(s)
+}
+
+func (s *replaySeq) plan(ctx context.Context, eval bool) (*plan, error) {
+	p, err := s.tasks.plan(ctx, eval)
+	if err == nil {
+		p.label = "sequence (replay stdin)"
+	}
+	return p, err
+}
+
+func (s *replaySeq) String() string {
+	return describe(s)
+}
@@ -0,0 +1,414 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultProbeInterval is the time between readiness checks of a
+// service.
+const DefaultProbeInterval = 100 * time.Millisecond
+
+// Probe checks whether a service is ready.
+type Probe struct {
+	// check is called with the output of the service so far.
+	check func(ctx context.Context, log []byte) (bool, error)
+
+	// shell is the shell equivalent of the check.
+	shell string
+
+	// log is set if the check uses the output of the service.
+	log bool
+}
+
+// PortOpen is ready once a TCP connection to the address succeeds.
+func PortOpen(addr string) Probe {
+	check := func(ctx context.Context, _ []byte) (bool, error) {
+		d := net.Dialer{Timeout: time.Second}
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return false, nil
+		}
+		return true, conn.Close()
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+	return Probe{check: check, shell: "nc -z " + shQuote(host) + " " + shQuote(port)}
+}
+
+// HTTPReady is ready once a GET request to the URL returns status 200.
+func HTTPReady(url string) Probe {
+	check := func(ctx context.Context, _ []byte) (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return false, err
+		}
+		client := http.Client{Timeout: time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return false, nil
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK, nil
+	}
+	return Probe{check: check, shell: "curl -sf -o /dev/null " + shQuote(url)}
+}
+
+// FileExists is ready once the file exists. Relative paths are
+// resolved against the directory set via Dir.
+func FileExists(path string) Probe {
+	check := func(ctx context.Context, _ []byte) (bool, error) {
+		_, err := os.Stat(environFrom(ctx).path(path))
+		return err == nil, nil
+	}
+	return Probe{check: check, shell: "test -e " + shQuote(path)}
+}
+
+// LogMatches is ready once a line of the output of the service
+// matches the regular expression.
+func LogMatches(pattern string) Probe {
+	re, err := regexp.Compile("(?m)" + pattern)
+	check := func(ctx context.Context, log []byte) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		return re.Match(log), nil
+	}
+	return Probe{check: check, shell: "grep -qE " + shQuote(pattern) + " service.log", log: true}
+}
+
+// ServiceOptions configures ServiceWith.
+type ServiceOptions struct {
+	// Interval is the time between readiness checks. Zero means
+	// DefaultProbeInterval.
+	Interval time.Duration
+
+	// Timeout is the maximum time to wait for the service to be
+	// ready. Zero means no limit.
+	Timeout time.Duration
+}
+
+// Service describes a long running task, such as a server, which is
+// ready once the probe succeeds.  Services are meant to be used with
+// With.
+//
+// When run by itself, a service is like the underlying task.
+func Service(t Task, probe Probe) Task {
+	return ServiceWith(ServiceOptions{}, t, probe)
+}
+
+// ServiceWith is like Service but with options to control the
+// readiness checks.
+func ServiceWith(opts ServiceOptions, t Task, probe Probe) Task {
+	return &service{task: t, probe: probe, opts: opts, stdout: os.Stdout}
+}
+
+type service struct {
+	task    Task
+	probe   Probe
+	opts    ServiceOptions
+	stdout  io.Writer
+	running Task
+}
+
+// Start also provides the output of the service to the With which
+// runs it, if any, when the probe needs it.
+func (s *service) Start(ctx context.Context) error {
+	stdout := s.stdout
+	if st, ok := ctx.Value(serviceKey{}).(*serviceState); ok && st.attach(ctx) && s.probe.log {
+		stdout = io.MultiWriter(stdout, st)
+	}
+	s.running = s.task.Stdout(stdout)
+	return s.running.Start(ctx)
+}
+
+func (s *service) Wait(ctx context.Context) error {
+	if s.running == nil {
+		return nil
+	}
+	return s.running.Wait(ctx)
+}
+
+func (s *service) instance() Task {
+	return &service{task: instance(s.task), probe: s.probe, opts: s.opts, stdout: s.stdout}
+}
+
+func (s *service) Stdin(r io.Reader) Task {
+	return &service{task: s.task.Stdin(r), probe: s.probe, opts: s.opts, stdout: s.stdout}
+}
+
+func (s *service) Stdout(w io.Writer) Task {
+	return &service{task: s.task, probe: s.probe, opts: s.opts, stdout: w}
+}
+
+func (s *service) Stderr(w io.Writer) Task {
+	return &service{task: s.task.Stderr(w), probe: s.probe, opts: s.opts, stdout: s.stdout}
+}
+
+func (s *service) plan(ctx context.Context, eval bool) (*plan, error) {
+	p, err := planOf(ctx, s.task, eval)
+	if err != nil {
+		return nil, err
+	}
+	label := "service ready when " + s.probe.shell
+	return &plan{label: label, shell: p.shell, level: p.level, children: []*plan{p}}, nil
+}
+
+func (s *service) String() string {
+	return describe(s)
+}
+
+// unwrapper is implemented by tasks which wrap another task, such as
+// Dir or Prefixed, so that With can find a service within them.
+type unwrapper interface {
+	unwrap() Task
+}
+
+// serviceOf finds the service which the task wraps, if any.
+func serviceOf(t Task) (*service, bool) {
+	for {
+		switch x := t.(type) {
+		case *service:
+			return x, true
+		case unwrapper:
+			t = x.unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+type serviceKey struct{}
+
+// serviceState is shared between With and the service it runs.
+type serviceState struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	attached bool
+
+	// log holds the output of the service until it is ready.
+	log   bytes.Buffer
+	ready bool
+}
+
+// Write adds to the log unless the service is already ready.
+func (st *serviceState) Write(p []byte) (int, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.ready {
+		st.log.Write(p)
+	}
+	return len(p), nil
+}
+
+// logged returns a copy of the log so far.
+func (st *serviceState) logged() []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]byte(nil), st.log.Bytes()...)
+}
+
+// markReady drops the log as probes no longer need it.
+func (st *serviceState) markReady() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.ready = true
+	st.log = bytes.Buffer{}
+}
+
+// attach records the context the service was started with, which
+// includes its working directory.  Only the first service started
+// is attached.
+func (st *serviceState) attach(ctx context.Context) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.attached {
+		return false
+	}
+	st.ctx, st.attached = ctx, true
+	return true
+}
+
+// context returns the context of the service or the provided
+// context if the service has not started.
+func (st *serviceState) context(ctx context.Context) context.Context {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.ctx == nil {
+		return ctx
+	}
+	return st.ctx
+}
+
+// With starts the service, waits for it to be ready and then runs
+// the body.  The service is stopped once the body finishes or fails
+// by cancelling its context: commands are sent SIGTERM, followed by
+// SIGKILL after the GracePeriod.
+//
+// The service may be wrapped, for example with Dir or GracePeriod.
+// If it is not created via Service, it is considered ready as soon
+// as it starts.
+//
+// With fails if the service exits before it is ready, if it does not
+// become ready within the timeout of the service or if the body
+// fails.  Errors of the service after it is stopped are ignored.
+//
+// Input provided via Stdin goes to the body while output goes to
+// both the service and the body.
+func With(svc, body Task) Task {
+	return &with{svc: svc, body: body}
+}
+
+type with struct {
+	svc, body Task
+	bg        *background
+}
+
+func (w *with) Start(ctx context.Context) error {
+	w.bg = runBackground(ctx, w.run)
+	return nil
+}
+
+func (w *with) Wait(ctx context.Context) error {
+	if w.bg == nil {
+		return nil
+	}
+	return w.bg.wait(ctx, false)
+}
+
+func (w *with) run(ctx context.Context) error {
+	svc, ok := serviceOf(w.svc)
+	if !ok {
+		svc = &service{probe: Probe{check: func(context.Context, []byte) (bool, error) {
+			return true, nil
+		}}}
+	}
+
+	st := &serviceState{}
+	svcCtx, stop := context.WithCancel(context.WithValue(ctx, serviceKey{}, st))
+	defer stop()
+	running := instance(w.svc)
+	if err := running.Start(svcCtx); err != nil {
+		stop()
+		_ = running.Wait(svcCtx)
+		return err
+	}
+
+	var svcErr error
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		svcErr = running.Wait(svcCtx)
+	}()
+
+	err := svc.waitReady(ctx, st, exited)
+	if errors.Is(err, errServiceExited) && svcErr != nil {
+		err = fmt.Errorf("%v: %w", err, svcErr)
+	}
+	if err == nil {
+		st.markReady()
+		err = Run(ctx, w.body)
+	}
+
+	select {
+	case <-exited:
+		if err == nil && svcErr != nil {
+			err = fmt.Errorf("service failed: %w", svcErr)
+		}
+	default:
+		stop()
+		<-exited
+	}
+	return waitErr(ctx, err)
+}
+
+var errServiceExited = errors.New("service exited before it was ready") //nolint: gochecknoglobals
+
+// waitReady polls the probe till the service is ready.  The probe
+// uses the context of the service, so that paths are resolved
+// relative to its working directory.
+func (s *service) waitReady(ctx context.Context, st *serviceState, exited chan struct{}) error {
+	interval := s.opts.Interval
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+	var timeout <-chan time.Time
+	if s.opts.Timeout > 0 {
+		timer := time.NewTimer(s.opts.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ready, err := s.probe.check(st.context(ctx), st.logged())
+		if ready || err != nil {
+			return err
+		}
+
+		select {
+		case <-exited:
+			return errServiceExited
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return fmt.Errorf("service not ready after %v", s.opts.Timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stdin provides input to the body.
+func (w *with) Stdin(r io.Reader) Task {
+	return &with{svc: w.svc, body: w.body.Stdin(r)}
+}
+
+func (w *with) Stdout(wr io.Writer) Task {
+	return &with{svc: w.svc.Stdout(wr), body: w.body.Stdout(wr)}
+}
+
+func (w *with) Stderr(wr io.Writer) Task {
+	return &with{svc: w.svc.Stderr(wr), body: w.body.Stderr(wr)}
+}
+
+func (w *with) instance() Task {
+	return &with{svc: w.svc, body: w.body}
+}
+
+func (w *with) plan(ctx context.Context, eval bool) (*plan, error) {
+	svc, err := planOf(ctx, w.svc, eval)
+	if err != nil {
+		return nil, err
+	}
+	body, err := planOf(ctx, w.body, eval)
+	if err != nil {
+		return nil, err
+	}
+
+	start := svc.wrap(shPipeline) + " &"
+	ready := ""
+	if s, ok := serviceOf(w.svc); ok {
+		if s.probe.log {
+			start = svc.wrap(shPipeline) + " > service.log &"
+		}
+		ready = "until " + s.probe.shell + "; do sleep 0.1; done; "
+	}
+	shell := start + " " + ready + body.wrap(shAndOr) + "; kill $!"
+	return &plan{label: "with", shell: shell, level: shList, children: []*plan{svc, body}}, nil
+}
+
+func (w *with) String() string {
+	return describe(w)
+}
@@ -0,0 +1,282 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleWith() {
+	server := script.Service(
+		script.Func(func(ctx context.Context, _ io.Reader, w io.Writer) error {
+			fmt.Fprintln(w, "listening")
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		script.LogMatches("^listening$"),
+	)
+	task := script.With(server, script.Echo("ready"))
+	if err := script.Run(context.Background(), task); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// listening
+	// ready
+}
+
+func ExampleWith_dryRun() {
+	task := script.With(
+		script.Service(script.Cmd("./server"), script.PortOpen("localhost:8080")),
+		script.Cmd("curl", "localhost:8080"),
+	)
+	if err := script.DryRunShell(context.Background(), os.Stdout, task); err != nil {
+		fmt.Println("error", err)
+	}
+	if err := script.DryRun(context.Background(), os.Stdout, task); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// ./server & until nc -z localhost 8080; do sleep 0.1; done; curl localhost:8080; kill $!
+	// with
+	//   service ready when nc -z localhost 8080
+	//     ./server
+	//   curl localhost:8080
+}
+
+func TestServiceProbes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("PortOpen", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := l.Addr().String()
+		l.Close()
+
+		server := script.Func(func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+			time.Sleep(20 * time.Millisecond)
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			defer l.Close()
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		body := script.Func(func(context.Context, io.Reader, io.Writer) error {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		})
+		if err := script.Run(ctx, script.With(script.Service(server, script.PortOpen(addr)), body)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("HTTPReady", func(t *testing.T) {
+		healthy := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-healthy:
+			default:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer ts.Close()
+
+		server := script.Func(func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+			time.Sleep(20 * time.Millisecond)
+			close(healthy)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		body := script.Func(func(context.Context, io.Reader, io.Writer) error {
+			select {
+			case <-healthy:
+				return nil
+			default:
+				return errors.New("body ran before ready")
+			}
+		})
+		if err := script.Run(ctx, script.With(script.Service(server, script.HTTPReady(ts.URL)), body)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("FileExists", func(t *testing.T) {
+		dir := t.TempDir()
+		server := script.Sequence(script.Cmd("sleep", "0.05"), script.Touch("ready"), script.Cmd("sleep", "10"))
+		task := script.With(script.Service(server, script.FileExists("ready")), script.Cat("ready"))
+		if err := script.Run(ctx, script.Dir(dir, task)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("LogMatches", func(t *testing.T) {
+		server := script.Sequence(
+			script.Echo("starting"),
+			script.Echo("ready on port 42"),
+			script.Func(func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+		)
+		task := script.With(script.Service(server, script.LogMatches(`^ready on port \d+$`)), script.Echo("body"))
+		out, err := script.Output(ctx, task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "starting\nready on port 42\nbody\n" {
+			t.Errorf("unexpected output %q", out)
+		}
+	})
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		task := script.With(script.Service(script.Echo("x"), script.LogMatches("(")).Stdout(io.Discard), script.Echo("body"))
+		if err := script.Run(ctx, task); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestServiceNotReady(t *testing.T) {
+	ctx := context.Background()
+	body := script.Func(func(context.Context, io.Reader, io.Writer) error {
+		return errors.New("body should not run")
+	})
+
+	// a service which exits early fails.
+	exits := script.Service(script.Cmd("false"), script.FileExists("never"))
+	err := script.Run(ctx, script.With(exits, body))
+	if err == nil || !strings.Contains(err.Error(), "service exited before it was ready") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var exitErr *script.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("expected ExitError, got %v", err)
+	}
+
+	// a service which does not become ready times out.
+	opts := script.ServiceOptions{Interval: time.Millisecond, Timeout: 50 * time.Millisecond}
+	slow := script.ServiceWith(opts, script.Cmd("sleep", "10"), script.FileExists(filepath.Join(t.TempDir(), "never")))
+	start := time.Now()
+	err = script.Run(ctx, script.With(slow, body))
+	if err == nil || !strings.Contains(err.Error(), "not ready") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("service not stopped promptly: %v", d)
+	}
+}
+
+func TestServiceStopped(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires signals")
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// the service traps SIGTERM to record that it was stopped
+	// gracefully.
+	server := script.Service(
+		script.Cmd("sh", "-c", "trap 'touch stopped; exit 0' TERM; echo up; while :; do sleep 0.01; done").Stderr(io.Discard),
+		script.LogMatches("up"),
+	)
+	for _, body := range []script.Task{script.Echo("ok"), script.Cmd("false")} {
+		os.Remove(filepath.Join(dir, "stopped"))
+		bodyErr := script.Run(ctx, body.Stdout(io.Discard))
+		_, err := script.Output(ctx, script.Dir(dir, script.With(server, body)))
+		if (err == nil) != (bodyErr == nil) {
+			t.Errorf("%v: unexpected error %v", body, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "stopped")); err != nil {
+			t.Errorf("%v: service was not stopped gracefully: %v", body, err)
+		}
+	}
+}
+
+func TestServiceFailure(t *testing.T) {
+	ctx := context.Background()
+	server := script.Service(script.Sequence(script.Echo("up"), script.Cmd("sh", "-c", "sleep 0.3; exit 3")), script.LogMatches("up"))
+	body := script.Func(func(context.Context, io.Reader, io.Writer) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	_, err := script.Output(ctx, script.With(server, body))
+	var exitErr *script.ExitError
+	if err == nil || !errors.As(err, &exitErr) || exitErr.ExitCode != 3 {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestServiceWithPlainTask(t *testing.T) {
+	ctx := context.Background()
+	started := make(chan struct{})
+	server := script.Func(func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	body := script.Func(func(ctx context.Context, _ io.Reader, _ io.Writer) error {
+		select {
+		case <-started:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("server not started")
+		}
+	})
+	if err := script.Run(ctx, script.With(server, body)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceWrapped(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// the probe is found through the wrappers and the file is
+	// resolved relative to the directory of the service.
+	server := script.Sequence(script.Cmd("sleep", "0.2"), script.Touch("ready"), script.Cmd("sleep", "10"))
+	body := script.Func(func(context.Context, io.Reader, io.Writer) error {
+		_, err := os.Stat(filepath.Join(dir, "ready"))
+		return err
+	})
+	task := script.With(script.Dir(dir, script.Service(server, script.FileExists("ready"))), body)
+	if err := script.Run(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	// output is available to the probe even when prefixed.
+	echo := script.Sequence(script.Cmd("sleep", "0.2"), script.Echo("up"), script.Cmd("sleep", "10"))
+	svc := script.GracePeriod(time.Second, script.Prefixed("svc", script.Service(echo, script.LogMatches("^up$"))))
+	out, err := script.Output(ctx, script.With(svc, script.Echo("body")))
+	if err != nil || out != "svc | up\nbody\n" {
+		t.Fatalf("unexpected %q %v", out, err)
+	}
+
+	var shell strings.Builder
+	if err := script.DryRunShell(ctx, &shell, task); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(shell.String(), "until test -e ready") {
+		t.Error("probe missing from plan", shell.String())
+	}
+}
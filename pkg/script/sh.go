@@ -0,0 +1,452 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Sh parses a command line written in a subset of the POSIX shell
+// syntax into a task, without invoking a shell:
+//
+//     task := script.Sh("go test ./... | tee out.txt && echo ok || echo fail")
+//
+// The supported syntax is:
+//
+//     a | b        Pipe(a, b)
+//     a && b       If(a, b, nil)
+//     a || b       If(a, nil, b)
+//     a; b         Sequence(IgnoreError(a), b)
+//     < f, > f     pipe from or to File(f)
+//     >> f         pipe to AppendFile(f)
+//     2> f, 2>> f  write or append stderr to the file f
+//     2>&1         MergeStderr (regardless of its position)
+//     K=V cmd      Env([]string{"K=V"}, cmd)
+//
+// Words can be quoted with single quotes, double quotes or a
+// backslash.  Variables ($VAR or ${VAR}) outside single quotes are
+// expanded with the process environment when Sh is called.  Unlike
+// the shell, expanded values are not split into multiple words and
+// no globbing is done.  Other syntax, such as subshells, background
+// jobs or redirections like ">&2", is rejected.
+//
+// If the command line cannot be parsed, the returned task fails with
+// the parse error when started. Use ParseSh to check for errors
+// upfront.
+func Sh(line string) Task {
+	t, err := ParseSh(line)
+	if err != nil {
+		return Error(err)
+	}
+	return t
+}
+
+// ParseSh is like Sh but returns any parse error.
+func ParseSh(line string) (Task, error) {
+	tokens, err := shLex(line)
+	if err != nil {
+		return nil, err
+	}
+	p := &shParser{tokens: tokens, lookup: os.Getenv}
+	t, err := p.list()
+	if err == nil && !p.done() {
+		err = fmt.Errorf("sh: unexpected %q", p.peek().value)
+	}
+	return t, err
+}
+
+// Error returns a task which fails with the provided error when
+// started.
+func Error(err error) Task {
+	return Describe("false", Func(func(ctx context.Context, r io.Reader, w io.Writer) error {
+		return err
+	}))
+}
+
+type shToken struct {
+	op    string // empty for words
+	value string // raw text for words
+}
+
+var shOps = []string{"&&", "||", ">>", "|", ";", "\n", "<", ">", "&"} //nolint: gochecknoglobals
+
+func shLex(line string) ([]shToken, error) {
+	var tokens []shToken
+	for len(line) > 0 {
+		switch c := line[0]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			line = line[1:]
+			continue
+		case c == '#':
+			if idx := strings.IndexByte(line, '\n'); idx != -1 {
+				line = line[idx:]
+			} else {
+				line = ""
+			}
+			continue
+		}
+
+		if c := line[0]; c == '(' || c == ')' {
+			return nil, fmt.Errorf("sh: subshells are not supported")
+		}
+
+		if n, op, err := shFdOp(line); err != nil {
+			return nil, err
+		} else if n > 0 {
+			tokens = append(tokens, shToken{op: op, value: line[:n]})
+			line = line[n:]
+			continue
+		}
+
+		if op := shOp(line); op != "" {
+			if op == "&" && strings.HasPrefix(line, "&>") {
+				return nil, fmt.Errorf("sh: unsupported redirection &>")
+			}
+			if op == "&" {
+				return nil, fmt.Errorf("sh: background jobs (&) are not supported")
+			}
+			tokens = append(tokens, shToken{op: op, value: op})
+			line = line[len(op):]
+			continue
+		}
+
+		n, err := shWordLen(line)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, shToken{value: line[:n]})
+		line = line[n:]
+	}
+	return tokens, nil
+}
+
+func shOp(line string) string {
+	for _, op := range shOps {
+		if strings.HasPrefix(line, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// shFdOp lexes a redirection of a file descriptor, such as "2>", at
+// the start of line.  It returns the length of the redirection and
+// the equivalent operator, or zero if line does not start with one.
+func shFdOp(line string) (int, string, error) {
+	n := 0
+	for n < len(line) && line[n] >= '0' && line[n] <= '9' {
+		n++
+	}
+	if n == len(line) || (line[n] != '<' && line[n] != '>') {
+		return 0, "", nil
+	}
+
+	// duplicating descriptors ("N>&M", ">&M") is only supported as
+	// the "2>&1" operator.
+	if dup := strings.IndexByte(line[n:], '&'); dup == 1 || dup == 2 && line[n+1] == '>' {
+		m := n + dup + 1
+		for m < len(line) && (line[m] >= '0' && line[m] <= '9' || line[m] == '-') {
+			m++
+		}
+		if line[:m] == "2>&1" {
+			return m, "2>&1", nil
+		}
+		return 0, "", fmt.Errorf("sh: unsupported redirection %s", line[:m])
+	}
+	if n == 0 {
+		return 0, "", nil
+	}
+
+	op := shOp(line[n:])
+	switch fd := line[:n]; {
+	case fd == "0" && op == "<", fd == "1" && (op == ">" || op == ">>"):
+		return n + len(op), op, nil
+	case fd == "2" && (op == ">" || op == ">>"):
+		return n + len(op), fd + op, nil
+	}
+	return 0, "", fmt.Errorf("sh: unsupported redirection %s", line[:n+len(op)])
+}
+
+// shWordLen returns the length of the word at the start of line.
+func shWordLen(line string) (int, error) {
+	for kk := 0; kk < len(line); kk++ {
+		switch line[kk] {
+		case ' ', '\t', '\r', '\n', '|', '&', ';', '<', '>', '(', ')':
+			return kk, nil
+		case '\\':
+			kk++
+		case '\'':
+			idx := strings.IndexByte(line[kk+1:], '\'')
+			if idx == -1 {
+				return 0, fmt.Errorf("sh: unterminated single quote")
+			}
+			kk += idx + 1
+		case '"':
+			for kk++; kk < len(line) && line[kk] != '"'; kk++ {
+				if line[kk] == '\\' {
+					kk++
+				}
+			}
+			if kk >= len(line) {
+				return 0, fmt.Errorf("sh: unterminated double quote")
+			}
+		}
+	}
+	return len(line), nil
+}
+
+type shParser struct {
+	tokens []shToken
+	lookup func(key string) string
+}
+
+func (p *shParser) done() bool {
+	return len(p.tokens) == 0
+}
+
+func (p *shParser) peek() shToken {
+	return p.tokens[0]
+}
+
+func (p *shParser) next() shToken {
+	t := p.tokens[0]
+	p.tokens = p.tokens[1:]
+	return t
+}
+
+func (p *shParser) skipNewlines() {
+	for !p.done() && p.peek().op == "\n" {
+		p.next()
+	}
+}
+
+// list := and_or ((';' | '\n') and_or)* [';' | '\n']
+func (p *shParser) list() (Task, error) {
+	var tasks []Task
+	for {
+		p.skipNewlines()
+		if p.done() {
+			break
+		}
+		t, err := p.andOr()
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+		if p.done() || (p.peek().op != ";" && p.peek().op != "\n") {
+			break
+		}
+		p.next()
+	}
+
+	switch len(tasks) {
+	case 0:
+		return nil, fmt.Errorf("sh: empty command")
+	case 1:
+		return tasks[0], nil
+	}
+	for kk := range tasks[:len(tasks)-1] {
+		tasks[kk] = IgnoreError(tasks[kk])
+	}
+	return Sequence(tasks...), nil
+}
+
+// andOr := pipeline (('&&' | '||') pipeline)*
+func (p *shParser) andOr() (Task, error) {
+	result, err := p.pipeline()
+	for err == nil && !p.done() && (p.peek().op == "&&" || p.peek().op == "||") {
+		op := p.next().op
+		p.skipNewlines()
+		var t Task
+		if t, err = p.pipeline(); err == nil {
+			if op == "&&" {
+				result = If(result, t, nil)
+			} else {
+				result = If(result, nil, t)
+			}
+		}
+	}
+	return result, err
+}
+
+// pipeline := command ('|' command)*
+func (p *shParser) pipeline() (Task, error) {
+	var tasks []Task
+	for {
+		t, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+		if p.done() || p.peek().op != "|" {
+			break
+		}
+		p.next()
+		p.skipNewlines()
+	}
+	if len(tasks) == 1 {
+		return tasks[0], nil
+	}
+	return Pipe(tasks...), nil
+}
+
+// command := (assignment)* (word | redirection)*
+func (p *shParser) command() (Task, error) {
+	var env, args []string
+	var in, out Task
+	var errPath string
+	merge, errAppend := false, false
+
+	for !p.done() {
+		tok := p.peek()
+		switch tok.op {
+		case "":
+			p.next()
+			if len(args) == 0 && shIsAssignment(tok.value) {
+				env = append(env, p.expand(tok.value))
+			} else if word, ok := p.word(tok.value); ok {
+				args = append(args, word)
+			}
+			continue
+		case "2>&1":
+			p.next()
+			merge = true
+			continue
+		case "<", ">", ">>", "2>", "2>>":
+			p.next()
+			if p.done() || p.peek().op != "" {
+				return nil, fmt.Errorf("sh: missing file name after %s", tok.op)
+			}
+			path := p.expand(p.next().value)
+			switch tok.op {
+			case "<":
+				in = File(path)
+			case ">":
+				out = File(path)
+			case ">>":
+				out = AppendFile(path)
+			default:
+				errPath, errAppend = path, tok.op == "2>>"
+			}
+			continue
+		}
+		break
+	}
+
+	if len(args) == 0 {
+		if len(env) > 0 {
+			return nil, fmt.Errorf("sh: standalone assignments are not supported")
+		}
+		if p.done() {
+			return nil, fmt.Errorf("sh: missing command")
+		}
+		return nil, fmt.Errorf("sh: unexpected %q", p.peek().value)
+	}
+
+	result := Cmd(args[0], args[1:]...)
+	if len(env) > 0 {
+		result = Env(env, result)
+	}
+	if merge && errPath != "" {
+		return nil, fmt.Errorf("sh: 2>&1 cannot be combined with 2> %s", errPath)
+	}
+	if merge {
+		result = MergeStderr(result)
+	}
+	if errPath != "" {
+		result = &stderrFile{Task: result, path: errPath, append: errAppend}
+	}
+
+	stages := []Task{result}
+	if in != nil {
+		stages = append([]Task{in}, stages...)
+	}
+	if out != nil {
+		stages = append(stages, out)
+	}
+	if len(stages) == 1 {
+		return result, nil
+	}
+	return Pipe(stages...), nil
+}
+
+func shIsAssignment(word string) bool {
+	idx := strings.IndexByte(word, '=')
+	if idx <= 0 {
+		return false
+	}
+	for kk, c := range word[:idx] {
+		isAlpha := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isAlpha && (kk == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// word expands a raw word. It returns false if the word should be
+// dropped, which is the case with unquoted expansions that are
+// empty.
+func (p *shParser) word(raw string) (string, bool) {
+	s := p.expand(raw)
+	return s, s != "" || strings.ContainsAny(raw, `'"`)
+}
+
+// expand removes quotes and expands variables in a raw word.
+func (p *shParser) expand(raw string) string {
+	var b strings.Builder
+	for kk := 0; kk < len(raw); kk++ {
+		switch c := raw[kk]; c {
+		case '\\':
+			if kk+1 < len(raw) {
+				kk++
+				b.WriteByte(raw[kk])
+			}
+		case '\'':
+			end := kk + 1 + strings.IndexByte(raw[kk+1:], '\'')
+			b.WriteString(raw[kk+1 : end])
+			kk = end
+		case '"':
+			for kk++; raw[kk] != '"'; kk++ {
+				switch {
+				case raw[kk] == '\\' && strings.IndexByte("$\"\\`", raw[kk+1]) != -1:
+					kk++
+					b.WriteByte(raw[kk])
+				case raw[kk] == '$':
+					kk += p.variable(&b, raw[kk:]) - 1
+				default:
+					b.WriteByte(raw[kk])
+				}
+			}
+		case '$':
+			kk += p.variable(&b, raw[kk:]) - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// variable expands the variable reference at the start of s, which
+// starts with '$'. It returns the number of bytes consumed.
+func (p *shParser) variable(b *strings.Builder, s string) int {
+	if strings.HasPrefix(s, "${") {
+		if end := strings.IndexByte(s, '}'); end != -1 {
+			b.WriteString(p.lookup(s[2:end]))
+			return end + 1
+		}
+	}
+
+	n := 1
+	for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || n > 1 && s[n] >= '0' && s[n] <= '9') {
+		n++
+	}
+	if n == 1 {
+		b.WriteByte('$')
+		return 1
+	}
+	b.WriteString(p.lookup(s[1:n]))
+	return n
+}
@@ -0,0 +1,152 @@
+package script_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tvastar/gotools/pkg/script"
+)
+
+func ExampleSh() {
+	spec := script.Sh(`echo "hello  world" | sed 's/world/there/' && false || echo 'failed' \$HOME`)
+	err := script.Run(context.Background(), spec)
+	if err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// hello  there
+	// failed $HOME
+}
+
+func ExampleSh_redirect() {
+	dir, err := ioutil.TempDir("", "sh")
+	if err != nil {
+		fmt.Println("error", err)
+	}
+	defer os.RemoveAll(dir)
+
+	spec := script.Dir(dir, script.Sh(`
+		echo hello > out.txt
+		sh -c 'echo world >&2' >> out.txt 2>&1
+		GREETING=hi sh -c 'echo $GREETING' >> out.txt
+		cat < out.txt
+	`))
+	if err = script.Run(context.Background(), spec); err != nil {
+		fmt.Println("error", err)
+	}
+
+	// Output:
+	// hello
+	// world
+	// hi
+}
+
+func TestShSequenceIgnoresErrors(t *testing.T) {
+	out, err := script.Output(context.Background(), script.Sh("false; echo ok"))
+	if out != "ok\n" || err != nil {
+		t.Error("unexpected", out, err)
+	}
+
+	if err := script.Run(context.Background(), script.Sh("true; false")); err == nil {
+		t.Error("unexpected success")
+	}
+}
+
+func TestShExpansion(t *testing.T) {
+	os.Setenv("SH_TEST_VAR", "a b")
+	defer os.Unsetenv("SH_TEST_VAR")
+
+	lines, err := script.Lines(context.Background(), script.Sh(
+		`printf '%s\n' $SH_TEST_VAR "${SH_TEST_VAR}x" '$SH_TEST_VAR' $SH_TEST_UNSET "" a\ b`,
+	))
+	expected := []string{"a b", "a bx", "$SH_TEST_VAR", "", "a b"}
+	if fmt.Sprintf("%q", lines) != fmt.Sprintf("%q", expected) || err != nil {
+		t.Errorf("unexpected %q %v", lines, err)
+	}
+}
+
+func TestShErrors(t *testing.T) {
+	lines := []string{
+		"",
+		"echo 'hello",
+		`echo "hello`,
+		"echo hello &",
+		"echo hello |",
+		"echo hello >",
+		"FOO=bar",
+		"&& echo",
+		"echo a ; ; echo b",
+		"echo hello 3> out.txt",
+		"echo hello 2>",
+		"echo hello 2> err.txt 2>&1",
+	}
+	for _, line := range lines {
+		if _, err := script.ParseSh(line); err == nil {
+			t.Errorf("%q: unexpected success", line)
+		}
+		if err := script.Run(context.Background(), script.Sh(line)); err == nil {
+			t.Errorf("%q: unexpected run success", line)
+		}
+	}
+
+	if err := script.Run(context.Background(), script.Sh("cat < "+filepath.Join("testdata", "missing"))); err == nil {
+		t.Error("unexpected success")
+	}
+}
+
+func TestShUnsupportedErrors(t *testing.T) {
+	lines := map[string]string{
+		"echo a >&2":           "sh: unsupported redirection >&2",
+		"echo a 1>&2":          "sh: unsupported redirection 1>&2",
+		"echo a 2>&-":          "sh: unsupported redirection 2>&-",
+		"cat <&3":              "sh: unsupported redirection <&3",
+		"echo a &> out.txt":    "sh: unsupported redirection &>",
+		"(echo sub)":           "sh: subshells are not supported",
+		"echo a && (echo sub)": "sh: subshells are not supported",
+		"echo a(b)":            "sh: subshells are not supported",
+		"echo a &":             "sh: background jobs (&) are not supported",
+	}
+	for line, want := range lines {
+		if _, err := script.ParseSh(line); err == nil || err.Error() != want {
+			t.Errorf("%q: got %v, want %s", line, err, want)
+		}
+	}
+
+	// quoted parens and "2>&1" are still fine.
+	if _, err := script.ParseSh("echo '(a)' \\(b\\) 2>&1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShRedirectStderr(t *testing.T) {
+	ctx := context.Background()
+	out, err := script.Output(ctx, script.Sh("echo hi 2>/dev/null"))
+	if out != "hi\n" || err != nil {
+		t.Errorf("unexpected %q %v", out, err)
+	}
+
+	dir := t.TempDir()
+	out, err = script.Output(ctx, script.Dir(dir, script.Sh(`
+		sh -c 'echo out; echo err >&2' 2> err.txt
+		sh -c 'echo more >&2; echo stdout' 2>>err.txt 1> out.txt
+		cat 0< out.txt
+	`)))
+	if out != "out\nstdout\n" || err != nil {
+		t.Errorf("unexpected %q %v", out, err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "err.txt"))
+	if string(data) != "err\nmore\n" || err != nil {
+		t.Errorf("unexpected %q %v", data, err)
+	}
+
+	var shell strings.Builder
+	if err := script.DryRunShell(ctx, &shell, script.Sh("make 2>> log.txt")); err != nil || shell.String() != "make 2>> log.txt\n" {
+		t.Errorf("unexpected %q %v", shell.String(), err)
+	}
+}
@@ -0,0 +1,90 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Timeout runs the task with a deadline. Commands still running when
+// the deadline expires are killed.
+//
+// The error returned on expiry satisfies
+// errors.Is(err, context.DeadlineExceeded).
+func Timeout(d time.Duration, t Task) Task {
+	return &timeout{d: d, task: t}
+}
+
+type timeout struct {
+	d      time.Duration
+	task   Task
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (t *timeout) Start(ctx context.Context) error {
+	t.ctx, t.cancel = context.WithTimeout(ctx, t.d)
+	return t.task.Start(t.ctx)
+}
+
+func (t *timeout) Wait(ctx context.Context) error {
+	if t.ctx == nil {
+		return nil
+	}
+	defer t.cancel()
+	stop := propagate(ctx, t.cancel)
+	defer stop()
+
+	err := t.task.Wait(t.ctx)
+	if err != nil && t.ctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return &timeoutError{t.d, err}
+	}
+	return err
+}
+
+func (t *timeout) instance() Task {
+	return &timeout{d: t.d, task: instance(t.task)}
+}
+
+func (t *timeout) Stdin(r io.Reader) Task {
+	return &timeout{d: t.d, task: t.task.Stdin(r)}
+}
+
+func (t *timeout) Stdout(w io.Writer) Task {
+	return &timeout{d: t.d, task: t.task.Stdout(w)}
+}
+
+func (t *timeout) Stderr(w io.Writer) Task {
+	return &timeout{d: t.d, task: t.task.Stderr(w)}
+}
+
+type timeoutError struct {
+	d   time.Duration
+	err error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v: %v", e.d, e.err)
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+func (e *timeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+func (t *timeout) plan(ctx context.Context, eval bool) (*plan, error) {
+	p, err := planOf(ctx, t.task, eval)
+	if err != nil {
+		return nil, err
+	}
+	label := fmt.Sprintf("timeout %v", t.d)
+	return &plan{label: label, shell: label + " " + p.command(), children: []*plan{p}}, nil
+}
+
+func (t *timeout) String() string {
+	return describe(t)
+}
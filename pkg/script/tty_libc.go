@@ -0,0 +1,17 @@
+// +build aix solaris
+
+package script
+
+import "syscall"
+
+// foreground is always false as ioctl is not available via the
+// syscall package, so commands never take over the terminal.
+func foreground(fd int) bool {
+	return false
+}
+
+// toForeground fails as ioctl is not available via the syscall
+// package.
+func toForeground(fd int) error {
+	return syscall.ENOTSUP
+}
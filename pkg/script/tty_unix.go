@@ -0,0 +1,27 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package script
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// foreground checks if the Go program is in the foreground of the
+// terminal.  It is false if fd is not a terminal.
+func foreground(fd int) bool {
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp)))
+	return errno == 0 && int(pgrp) == syscall.Getpgrp()
+}
+
+// toForeground places the Go program in the foreground of the
+// terminal.
+func toForeground(fd int) error {
+	pgrp := int32(syscall.Getpgrp())
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&pgrp)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -19,8 +19,12 @@ func LastModifiedChecksum(path string) interface{} {
 //
 // If the checksum returns nil, the last checksum is uncached.
 func Dedup(checksum func(string) interface{}, s Stream) Stream {
+	return Filter(dedupAllow(checksum), s)
+}
+
+func dedupAllow(checksum func(string) interface{}) (allow func(path string) bool) {
 	checksums := map[string]interface{}{}
-	allow := func(path string) bool {
+	return func(path string) bool {
 		current := checksum(path)
 		old, ok := checksums[path]
 		if ok && old == current {
@@ -34,5 +38,4 @@ func Dedup(checksum func(string) interface{}, s Stream) Stream {
 		}
 		return true
 	}
-	return Filter(allow, s)
 }
@@ -12,17 +12,48 @@ import (
 // io.EOF instead. NextPath must not be called after an EOF is
 // returned.
 func DirSnap(root string) Stream {
+	return DirSnapWithErrors(root, nil)
+}
+
+// DirSnapWithErrors is like DirSnap but any error encountered while
+// walking a path (such as an unreadable directory) is reported to
+// onError instead of being silently dropped.
+//
+// If onError returns nil, the path is skipped and the snapshot
+// continues. Otherwise the snapshot is aborted and the returned
+// error is returned by NextPath.
+//
+// onError is called from a separate goroutine.  A nil onError ignores
+// all errors.
+func DirSnapWithErrors(root string, onError func(path string, err error) error) Stream {
+	return newSnap(func(visit func(path string) error) error {
+		return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err == nil {
+				return visit(path)
+			}
+			if onError != nil {
+				return onError(path, err)
+			}
+			return nil
+		})
+	})
+}
+
+// newSnap creates a snapshot stream out of a walk function.  The
+// walk function is expected to call visit for each path and abort
+// with the error returned by visit, if any.
+func newSnap(walk func(visit func(path string) error) error) *snap {
 	closed := make(chan error, 2) //nolint: mnd
-	return &dirsnap{root, closed, nil}
+	return &snap{walk, closed, nil}
 }
 
-type dirsnap struct {
-	root   string
+type snap struct {
+	walker func(visit func(path string) error) error
 	closed chan error
 	ch     chan string
 }
 
-func (d *dirsnap) NextPath(ctx context.Context) (string, error) {
+func (d *snap) NextPath(ctx context.Context) (string, error) {
 	if d.ch == nil {
 		d.ch = make(chan string)
 		go d.walk()
@@ -37,14 +68,12 @@ func (d *dirsnap) NextPath(ctx context.Context) (string, error) {
 	}
 }
 
-func (d *dirsnap) walk() {
-	err := filepath.Walk(d.root, func(path string, info os.FileInfo, err error) error {
-		if err == nil {
-			select {
-			case <-d.closed:
-				return io.EOF
-			case d.ch <- path:
-			}
+func (d *snap) walk() {
+	err := d.walker(func(path string) error {
+		select {
+		case <-d.closed:
+			return io.EOF
+		case d.ch <- path:
 		}
 		return nil
 	})
@@ -55,7 +84,7 @@ func (d *dirsnap) walk() {
 	d.closed <- err
 }
 
-func (d *dirsnap) Close() error {
+func (d *snap) Close() error {
 	d.closed <- io.EOF
 	return nil
 }
@@ -2,7 +2,14 @@ package watch_test
 
 import (
 	"context"
+	"errors"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"strings"
 	"testing"
 
@@ -32,3 +39,79 @@ func TestDirSnapPartialClose(t *testing.T) {
 		t.Fatal("close failed", err)
 	}
 }
+
+func TestDirSnapWithErrors(t *testing.T) {
+	var paths []string
+	onError := func(path string, err error) error {
+		paths = append(paths, path)
+		return nil
+	}
+
+	got, err := fetchAll(watch.DirSnapWithErrors("testdata/missing", onError))
+	if len(got) != 0 || err != io.EOF {
+		t.Error("unexpected", got, err)
+	}
+	if !reflect.DeepEqual(paths, []string{"testdata/missing"}) {
+		t.Error("unexpected errors", paths)
+	}
+}
+
+func TestDirSnapWithErrorsAbort(t *testing.T) {
+	someErr := errors.New("some error")
+	onError := func(path string, err error) error {
+		return someErr
+	}
+
+	got, err := fetchAll(watch.DirSnapWithErrors("testdata/missing", onError))
+	if len(got) != 0 || err != someErr {
+		t.Error("unexpected", got, err)
+	}
+}
+
+func TestDirSnapWithErrorsUnreadable(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced")
+	}
+
+	root := t.TempDir()
+	for _, name := range []string{"a/one.txt", "bad/hidden.txt", "z/two.txt"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bad := filepath.Join(root, "bad")
+	if err := os.Chmod(bad, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(bad, 0777)
+
+	var paths []string
+	onError := func(path string, err error) error {
+		paths = append(paths, path)
+		return nil
+	}
+	got, err := fetchAll(watch.DirSnapWithErrors(root, onError))
+	if err != io.EOF {
+		t.Error("unexpected", err)
+	}
+	if !reflect.DeepEqual(paths, []string{bad}) {
+		t.Error("unexpected errors", paths)
+	}
+
+	// the unreadable directory is skipped but its siblings are
+	// still walked.
+	var rel []string
+	for _, path := range got {
+		r, _ := filepath.Rel(root, path)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	sort.Strings(rel)
+	expected := []string{".", "a", "a/one.txt", "z", "z/two.txt"}
+	if !reflect.DeepEqual(rel, expected) {
+		t.Error("unexpected paths", rel)
+	}
+}
@@ -0,0 +1,55 @@
+package watch
+
+import (
+	"io/fs"
+	"time"
+)
+
+// FSSnap is like DirSnap but it walks the root directory of any
+// fs.FS (such as embed.FS, zip readers or fstest.MapFS).  The
+// returned paths are relative to fsys as with fs.WalkDir.
+func FSSnap(fsys fs.FS, root string) Stream {
+	return FSSnapWithErrors(fsys, root, nil)
+}
+
+// FSSnapWithErrors is like FSSnap but errors encountered while
+// walking are reported to onError. See DirSnapWithErrors for the
+// semantics of onError.
+func FSSnapWithErrors(fsys fs.FS, root string, onError func(path string, err error) error) Stream {
+	return newSnap(func(visit func(path string) error) error {
+		return fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+			if err == nil {
+				return visit(path)
+			}
+			if onError != nil {
+				return onError(path, err)
+			}
+			return nil
+		})
+	})
+}
+
+// FSLastModifiedChecksum is like LastModifiedChecksum but it stats
+// paths within the provided fs.FS.
+func FSLastModifiedChecksum(fsys fs.FS) func(path string) interface{} {
+	return func(path string) interface{} {
+		fi, err := fs.Stat(fsys, path)
+		if err != nil {
+			return nil
+		}
+		return fi.ModTime()
+	}
+}
+
+// FS returns a snapshot + all changes of the root directory within
+// fsys. Changes are detected by polling.
+func FS(fsys fs.FS, root string) Stream {
+	first := true
+	return Dedup(FSLastModifiedChecksum(fsys), Repeat(func() Stream {
+		if first {
+			first = false
+			return FSSnap(fsys, root)
+		}
+		return Delay(time.Minute, FSSnap(fsys, root))
+	}))
+}
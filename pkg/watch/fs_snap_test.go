@@ -0,0 +1,125 @@
+package watch_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/watch"
+)
+
+func TestFSSnap(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/one.txt":     {Data: []byte("one")},
+		"a/b/two.txt":   {Data: []byte("two")},
+		"c/ignored.txt": {Data: []byte("ignored")},
+	}
+
+	got, err := fetchAll(watch.FSSnap(fsys, "a"))
+	expected := []string{"a", "a/b", "a/b/two.txt", "a/one.txt"}
+	if !reflect.DeepEqual(expected, got) || err != io.EOF {
+		t.Error("unexpected", got, err)
+	}
+}
+
+func TestFSSnapPartialClose(t *testing.T) {
+	w := watch.FSSnap(fstest.MapFS{"one.txt": {}}, ".")
+	if _, err := w.NextPath(context.Background()); err != nil {
+		t.Fatal("unexpected", err)
+	}
+	if err := watch.Close(w); err != nil {
+		t.Fatal("close failed", err)
+	}
+}
+
+func TestFSLastModifiedChecksum(t *testing.T) {
+	now := time.Now()
+	fsys := fstest.MapFS{"one.txt": {ModTime: now}}
+	checksum := watch.FSLastModifiedChecksum(fsys)
+
+	if v := checksum("goop"); v != nil {
+		t.Error("unexpected last modified checksum", v)
+	}
+	if v := checksum("one.txt"); v != now {
+		t.Error("unexpected last modified checksum", v)
+	}
+}
+
+func TestFS(t *testing.T) {
+	fsys := fstest.MapFS{"one.txt": {}, "two.txt": {}}
+	w := watch.FS(fsys, ".")
+	defer watch.Close(w)
+
+	expected := []string{".", "one.txt", "two.txt"}
+	for _, e := range expected {
+		if p, err := w.NextPath(context.Background()); p != e || err != nil {
+			t.Fatal("unexpected", p, err)
+		}
+	}
+}
+
+func TestFSSnapWithErrors(t *testing.T) {
+	var paths []string
+	onError := func(path string, err error) error {
+		paths = append(paths, path)
+		return nil
+	}
+
+	fsys := fstest.MapFS{"one.txt": {}}
+	got, err := fetchAll(watch.FSSnapWithErrors(fsys, "missing", onError))
+	if len(got) != 0 || err != io.EOF {
+		t.Error("unexpected", got, err)
+	}
+	if !reflect.DeepEqual(paths, []string{"missing"}) {
+		t.Error("unexpected errors", paths)
+	}
+}
+
+// unreadableFS fails to read the directory bad.
+type unreadableFS struct {
+	fstest.MapFS
+	bad string
+}
+
+func (u unreadableFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == u.bad {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrPermission}
+	}
+	return u.MapFS.ReadDir(name)
+}
+
+func TestFSSnapWithErrorsUnreadable(t *testing.T) {
+	fsys := unreadableFS{
+		MapFS: fstest.MapFS{
+			"a/one.txt":      {},
+			"bad/hidden.txt": {},
+			"z/two.txt":      {},
+		},
+		bad: "bad",
+	}
+
+	var paths []string
+	onError := func(path string, err error) error {
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Error("unexpected error", err)
+		}
+		paths = append(paths, path)
+		return nil
+	}
+	got, err := fetchAll(watch.FSSnapWithErrors(fsys, ".", onError))
+	if err != io.EOF {
+		t.Error("unexpected", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"bad"}) {
+		t.Error("unexpected errors", paths)
+	}
+	expected := []string{".", "a", "a/one.txt", "bad", "z", "z/two.txt"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Error("unexpected paths", got)
+	}
+}
@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ManifestEntry is a single entry of a JSON directory manifest.
+//
+// A manifest is a JSON array of entries:
+//
+//     [{"path": "dist/app.tgz", "size": 1024, "etag": "abc"}, ...]
+type ManifestEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	ETag string `json:"etag"`
+}
+
+// Manifest polls a JSON directory manifest at url and returns the
+// paths that were added, removed or modified (as determined by the
+// size and etag) since the last poll. The first poll returns all
+// paths.
+//
+// If client is nil, http.DefaultClient is used.
+func Manifest(client *http.Client, url string, interval time.Duration) Stream {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	m := &manifest{client: client, url: url}
+	first := true
+	return Dedup(m.checksum, Repeat(func() Stream {
+		if first {
+			first = false
+			return m.snap()
+		}
+		return Delay(interval, m.snap())
+	}))
+}
+
+type manifest struct {
+	client  *http.Client
+	url     string
+	entries map[string]ManifestEntry
+}
+
+// checksum returns nil for paths that are no longer in the manifest.
+func (m *manifest) checksum(path string) interface{} {
+	if entry, ok := m.entries[path]; ok {
+		return entry
+	}
+	return nil
+}
+
+// snap returns a stream which fetches the manifest and returns all
+// paths in the current and previous manifest.
+func (m *manifest) snap() Stream {
+	var paths []string
+	fetched := false
+	return streamFunc(func(ctx context.Context) (string, error) {
+		if !fetched {
+			entries, err := m.fetch(ctx)
+			if err != nil {
+				return "", err
+			}
+			fetched = true
+			paths = mergePaths(m.entries, entries)
+			m.entries = entries
+		}
+		if len(paths) == 0 {
+			return "", io.EOF
+		}
+		next := paths[0]
+		paths = paths[1:]
+		return next, nil
+	})
+}
+
+func (m *manifest) fetch(ctx context.Context) (map[string]ManifestEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("manifest %s: %s", m.url, resp.Status)
+	}
+
+	var list []ManifestEntry
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", m.url, err)
+	}
+	entries := make(map[string]ManifestEntry, len(list))
+	for _, entry := range list {
+		entries[entry.Path] = entry
+	}
+	return entries, nil
+}
+
+func mergePaths(old, current map[string]ManifestEntry) []string {
+	paths := make([]string, 0, len(current))
+	for path := range current {
+		paths = append(paths, path)
+	}
+	for path := range old {
+		if _, ok := current[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+type streamFunc func(ctx context.Context) (string, error)
+
+func (f streamFunc) NextPath(ctx context.Context) (string, error) {
+	return f(ctx)
+}
@@ -0,0 +1,77 @@
+package watch_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tvastar/gotools/pkg/watch"
+)
+
+func TestManifest(t *testing.T) {
+	var mu sync.Mutex
+	entries := []watch.ManifestEntry{
+		{Path: "a.tgz", Size: 1, ETag: "a1"},
+		{Path: "b.tgz", Size: 1, ETag: "b1"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(entries)
+	}))
+	defer srv.Close()
+
+	w := watch.Manifest(srv.Client(), srv.URL, time.Millisecond)
+	defer watch.Close(w)
+
+	next := func(count int) []string {
+		paths := []string{}
+		for len(paths) < count {
+			p, err := w.NextPath(context.Background())
+			if err != nil {
+				t.Fatal("unexpected error", err)
+			}
+			paths = append(paths, p)
+		}
+		return paths
+	}
+
+	if got := next(2); !reflect.DeepEqual(got, []string{"a.tgz", "b.tgz"}) {
+		t.Error("unexpected", got)
+	}
+
+	mu.Lock()
+	entries = []watch.ManifestEntry{
+		{Path: "a.tgz", Size: 1, ETag: "a1"},
+		{Path: "c.tgz", Size: 1, ETag: "c1"},
+	}
+	mu.Unlock()
+	if got := next(2); !reflect.DeepEqual(got, []string{"b.tgz", "c.tgz"}) {
+		t.Error("unexpected", got)
+	}
+
+	mu.Lock()
+	entries = []watch.ManifestEntry{
+		{Path: "a.tgz", Size: 2, ETag: "a2"},
+		{Path: "c.tgz", Size: 1, ETag: "c1"},
+	}
+	mu.Unlock()
+	if got := next(1); !reflect.DeepEqual(got, []string{"a.tgz"}) {
+		t.Error("unexpected", got)
+	}
+}
+
+func TestManifestError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	w := watch.Manifest(nil, srv.URL, time.Millisecond)
+	if p, err := w.NextPath(context.Background()); err == nil {
+		t.Error("unexpected success", p)
+	}
+}
@@ -3,16 +3,79 @@ package watch
 import (
 	"context"
 	"io"
+	"time"
 )
 
 // Repeat calls the create function repeated, iterating through each
 // one until an io.EOF is returned.
 func Repeat(create func() Stream) Stream {
-	return &repeat{create, nil}
+	return &repeat{create: create}
+}
+
+// RetryPolicy configures how failures are retried, such as errors
+// other than io.EOF with RepeatWithRetry.  It is also used for
+// retrying tasks by the script package.
+type RetryPolicy struct {
+	// MaxAttempts is the number of consecutive failures after
+	// which the error is returned. Zero means retry forever.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, or
+	// DefaultBackoff if zero. It doubles with each consecutive
+	// failure.
+	Backoff time.Duration
+
+	// MaxBackoff caps the delay between retries. Zero means no
+	// cap.
+	MaxBackoff time.Duration
+
+	// Retryable classifies errors. Errors for which it returns
+	// false are returned immediately. If nil, all errors are
+	// considered retryable.
+	Retryable func(err error) bool
+
+	// OnError, if not nil, is called with every error seen along
+	// with the count of consecutive failures so far.
+	OnError func(err error, attempt int)
+}
+
+// DefaultBackoff is the delay before the first retry when the
+// policy does not specify one.
+const DefaultBackoff = 100 * time.Millisecond
+
+// BackoffAfter returns the backoff before retrying after the provided
+// number of consecutive failures.
+func (p RetryPolicy) BackoffAfter(failures int) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = DefaultBackoff
+	}
+	for kk := 1; kk < failures; kk++ {
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// RepeatWithRetry is like Repeat but errors from the current stream
+// are retried as per the policy by closing the failed stream and
+// creating a new one.  Context errors are never retried.
+//
+// The count of consecutive failures is reset whenever a path is
+// successfully returned.
+func RepeatWithRetry(policy RetryPolicy, create func() Stream) Stream {
+	return &repeat{create: create, policy: &policy}
 }
 
 type repeat struct {
-	create func() Stream
+	create   func() Stream
+	policy   *RetryPolicy
+	failures int
 	Stream
 }
 
@@ -21,13 +84,49 @@ func (p *repeat) NextPath(ctx context.Context) (string, error) {
 		if p.Stream == nil {
 			p.Stream = p.create()
 		}
-		if s, err := p.Stream.NextPath(ctx); err != io.EOF {
-			return s, err
+		s, err := p.Stream.NextPath(ctx)
+		if err == nil {
+			p.failures = 0
+			return s, nil
+		}
+		if err != io.EOF {
+			if err = p.retry(ctx, err); err != nil {
+				return s, err
+			}
+			_ = Close(p.Stream)
 		}
 		p.Stream = nil
 	}
 }
 
+// retry returns nil if the error can be retried. It waits for the
+// appropriate backoff before returning.
+func (p *repeat) retry(ctx context.Context, err error) error {
+	if p.policy == nil || ctx.Err() != nil {
+		return err
+	}
+
+	p.failures++
+	if p.policy.OnError != nil {
+		p.policy.OnError(err, p.failures)
+	}
+	if p.policy.Retryable != nil && !p.policy.Retryable(err) {
+		return err
+	}
+	if p.policy.MaxAttempts > 0 && p.failures >= p.policy.MaxAttempts {
+		return err
+	}
+
+	timer := time.NewTimer(p.policy.BackoffAfter(p.failures))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func (p *repeat) Close() error {
 	return Close(p.Stream)
 }
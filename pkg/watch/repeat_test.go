@@ -1,9 +1,11 @@
 package watch_test
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/tvastar/gotools/pkg/watch"
 )
@@ -32,3 +34,93 @@ func TestRepeat(t *testing.T) {
 		t.Error("unexpected", err)
 	}
 }
+
+func TestRepeatWithRetry(t *testing.T) {
+	someErr := errors.New("some error")
+
+	streams := []watch.Stream{
+		newFixedStream([]string{"hello"}),
+		watch.Error(someErr),
+		watch.Error(someErr),
+		newFixedStream([]string{"world"}),
+		watch.Error(someErr),
+		watch.Error(someErr),
+		watch.Error(someErr),
+	}
+	create := func() watch.Stream {
+		next := streams[0]
+		streams = streams[1:]
+		return next
+	}
+
+	attempts := []int{}
+	policy := watch.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+		OnError: func(err error, attempt int) {
+			attempts = append(attempts, attempt)
+		},
+	}
+
+	expected := []string{"hello", "world"}
+	w := watch.RepeatWithRetry(policy, create)
+	got, err := fetchAll(w)
+	if !reflect.DeepEqual(expected, got) || err != someErr {
+		t.Error("unexpected", got, err)
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 1, 2, 3}) {
+		t.Error("unexpected attempts", attempts)
+	}
+	if err = watch.Close(w); err != nil {
+		t.Error("unexpected", err)
+	}
+}
+
+func TestRepeatWithRetryFatal(t *testing.T) {
+	someErr := errors.New("some error")
+	policy := watch.RetryPolicy{
+		Retryable: func(err error) bool { return err != someErr },
+	}
+	w := watch.RepeatWithRetry(policy, func() watch.Stream {
+		return watch.Error(someErr)
+	})
+	if _, err := w.NextPath(context.Background()); err != someErr {
+		t.Error("unexpected", err)
+	}
+}
+
+func TestRepeatWithRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	policy := watch.RetryPolicy{Backoff: time.Hour}
+	w := watch.RepeatWithRetry(policy, func() watch.Stream {
+		return watch.Error(errors.New("some error"))
+	})
+	if _, err := w.NextPath(ctx); err != ctx.Err() {
+		t.Error("unexpected", err)
+	}
+}
+
+func TestRetryPolicyBackoffAfter(t *testing.T) {
+	policy := watch.RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	got := []time.Duration{}
+	for failures := 1; failures <= 5; failures++ {
+		got = append(got, policy.BackoffAfter(failures))
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	if !reflect.DeepEqual(got, expected) {
+		t.Error("Unexpected", got)
+	}
+}
+
+func TestRetryPolicyDefaultBackoff(t *testing.T) {
+	var policy watch.RetryPolicy
+	if d := policy.BackoffAfter(1); d != watch.DefaultBackoff {
+		t.Error("Unexpected", d)
+	}
+	if d := policy.BackoffAfter(3); d != 4*watch.DefaultBackoff {
+		t.Error("Unexpected", d)
+	}
+}
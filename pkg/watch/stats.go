@@ -0,0 +1,184 @@
+package watch
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Stats are the counters collected by a Monitor.
+type Stats struct {
+	// Emitted is the number of paths returned by monitored
+	// streams.
+	Emitted int64
+
+	// Errors is the number of errors other than io.EOF returned
+	// by monitored streams.
+	Errors int64
+
+	// Filtered is the number of paths dropped by monitored
+	// filters.
+	Filtered int64
+
+	// Deduped is the number of paths dropped by monitored
+	// dedups.
+	Deduped int64
+
+	// Walks is the number of completed walks and WalkTime is the
+	// total time taken by them.
+	Walks       int64
+	WalkTime    time.Duration
+	MaxWalkTime time.Duration
+
+	// Latency is the total time spent waiting in NextPath of
+	// monitored streams.
+	Latency    time.Duration
+	MaxLatency time.Duration
+}
+
+// String formats the stats on a single line.
+func (s Stats) String() string {
+	return fmt.Sprintf(
+		"emitted=%d errors=%d filtered=%d deduped=%d walks=%d walk_time=%v max_walk_time=%v latency=%v max_latency=%v",
+		s.Emitted, s.Errors, s.Filtered, s.Deduped, s.Walks, s.WalkTime, s.MaxWalkTime, s.Latency, s.MaxLatency,
+	)
+}
+
+// Monitor collects stats for streams via its instrumentation
+// wrappers. It is safe for concurrent use.
+//
+// A nil monitor is valid: its wrappers return the streams
+// unmodified.
+type Monitor struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewMonitor creates a new monitor.
+func NewMonitor() *Monitor {
+	return &Monitor{}
+}
+
+// Stats returns a snapshot of the current stats.
+func (m *Monitor) Stats() Stats {
+	if m == nil {
+		return Stats{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// Publish exports the stats via expvar with the provided name. Like
+// expvar.Publish, it panics if the name is already in use.
+func (m *Monitor) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Stats()
+	}))
+}
+
+// Stream counts the paths and errors returned by s as well as the
+// time spent in its NextPath.
+func (m *Monitor) Stream(s Stream) Stream {
+	if m == nil {
+		return s
+	}
+	return &monitored{m, s}
+}
+
+// Walk measures the time taken by a snapshot stream (such as
+// DirSnap) from the first call to NextPath till it returns io.EOF.
+func (m *Monitor) Walk(s Stream) Stream {
+	if m == nil {
+		return s
+	}
+	return &walked{m, s, time.Time{}}
+}
+
+// Filter is like Filter but counts the paths dropped.
+func (m *Monitor) Filter(allow func(path string) bool, s Stream) Stream {
+	if m == nil {
+		return Filter(allow, s)
+	}
+	return Filter(m.counted(&m.stats.Filtered, allow), s)
+}
+
+// Dedup is like Dedup but counts the paths dropped.
+func (m *Monitor) Dedup(checksum func(string) interface{}, s Stream) Stream {
+	if m == nil {
+		return Dedup(checksum, s)
+	}
+	return Filter(m.counted(&m.stats.Deduped, dedupAllow(checksum)), s)
+}
+
+func (m *Monitor) counted(counter *int64, allow func(path string) bool) func(path string) bool {
+	return func(path string) bool {
+		if allow(path) {
+			return true
+		}
+		m.mu.Lock()
+		*counter++
+		m.mu.Unlock()
+		return false
+	}
+}
+
+type monitored struct {
+	m *Monitor
+	s Stream
+}
+
+func (w *monitored) NextPath(ctx context.Context) (string, error) {
+	start := time.Now()
+	p, err := w.s.NextPath(ctx)
+	elapsed := time.Since(start)
+
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+	switch {
+	case err == nil:
+		w.m.stats.Emitted++
+	case err != io.EOF:
+		w.m.stats.Errors++
+	}
+	w.m.stats.Latency += elapsed
+	if elapsed > w.m.stats.MaxLatency {
+		w.m.stats.MaxLatency = elapsed
+	}
+	return p, err
+}
+
+func (w *monitored) Close() error {
+	return Close(w.s)
+}
+
+type walked struct {
+	m     *Monitor
+	s     Stream
+	start time.Time
+}
+
+func (w *walked) NextPath(ctx context.Context) (string, error) {
+	if w.start.IsZero() {
+		w.start = time.Now()
+	}
+	p, err := w.s.NextPath(ctx)
+	if err == io.EOF {
+		elapsed := time.Since(w.start)
+		w.m.mu.Lock()
+		w.m.stats.Walks++
+		w.m.stats.WalkTime += elapsed
+		if elapsed > w.m.stats.MaxWalkTime {
+			w.m.stats.MaxWalkTime = elapsed
+		}
+		w.m.mu.Unlock()
+	}
+	return p, err
+}
+
+func (w *walked) Close() error {
+	return Close(w.s)
+}
@@ -0,0 +1,56 @@
+package watch_test
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tvastar/gotools/pkg/watch"
+)
+
+func TestMonitor(t *testing.T) {
+	m := watch.NewMonitor()
+	s := newFixedStream([]string{"hello", "boo", "hello", "world", "hoo"})
+	checksum := func(s string) interface{} {
+		return s
+	}
+	allow := func(s string) bool {
+		return !strings.HasSuffix(s, "oo")
+	}
+
+	w := m.Stream(m.Filter(allow, m.Dedup(checksum, m.Walk(s))))
+	got, err := fetchAll(w)
+	expected := []string{"hello", "world"}
+	if !reflect.DeepEqual(expected, got) || err != io.EOF {
+		t.Error("unexpected", got, err)
+	}
+
+	stats := m.Stats()
+	if stats.Emitted != 2 || stats.Filtered != 2 || stats.Deduped != 1 || stats.Walks != 1 || stats.Errors != 0 {
+		t.Error("unexpected stats", stats)
+	}
+
+	// the published var keeps m alive, so its address is a name
+	// which is unique even when the test is repeated.
+	name := fmt.Sprintf("TestMonitor-%p", m)
+	m.Publish(name)
+	if v := expvar.Get(name); v == nil || !strings.Contains(v.String(), `"Emitted":2`) {
+		t.Error("unexpected expvar", v)
+	}
+}
+
+func TestMonitorNil(t *testing.T) {
+	var m *watch.Monitor
+	s := newFixedStream([]string{"hello", "boo"})
+	w := m.Stream(m.Filter(watch.Glob("*"), m.Dedup(watch.LastModifiedChecksum, m.Walk(s))))
+	got, err := fetchAll(w)
+	if !reflect.DeepEqual([]string{"hello", "boo"}, got) || err != io.EOF {
+		t.Error("unexpected", got, err)
+	}
+	if stats := m.Stats(); stats != (watch.Stats{}) {
+		t.Error("unexpected stats", stats)
+	}
+}
@@ -35,17 +35,23 @@ func Dir(dir string) Stream {
 // CurrentDir automatically picks the current dir but also filters
 // by the glob pattern.
 func CurrentDir(glob string) Stream {
+	return CurrentDirWithMonitor(glob, nil)
+}
+
+// CurrentDirWithMonitor is like CurrentDir but collects stats in the
+// provided monitor.
+func CurrentDirWithMonitor(glob string, m *Monitor) Stream {
 	cwd, err := os.Getwd()
 	if err != nil {
-		return Error(err)
+		return m.Stream(Error(err))
 	}
 	first := true
-	return Dedup(LastModifiedChecksum, Repeat(func() Stream {
-		filtered := Filter(Glob(glob), DirSnap(cwd))
+	return m.Stream(m.Dedup(LastModifiedChecksum, Repeat(func() Stream {
+		filtered := m.Filter(Glob(glob), m.Walk(DirSnap(cwd)))
 		if first {
 			first = false
 			return filtered
 		}
 		return Delay(time.Minute, filtered)
-	}))
+	})))
 }